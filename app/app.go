@@ -0,0 +1,32 @@
+//go:build appengine
+// +build appengine
+
+// Package app is the App Engine entry point for the evaluator described in
+// app.yaml. App Engine serves static/ itself. Named gold corpora are loaded
+// from the gold directory if there is one.
+package app
+
+import (
+	"net/http"
+	"os"
+
+	"appengine"
+
+	"github.com/srush/nlp-course/server"
+)
+
+func init() {
+	config := server.Config{
+		Logger: func(r *http.Request) server.Logger {
+			return appengine.NewContext(r)
+		},
+	}
+	if _, err := os.Stat("gold"); err == nil {
+		gold, err := server.LoadGoldCorpora("gold")
+		if err != nil {
+			panic(err)
+		}
+		config.Gold = gold
+	}
+	http.Handle("/", server.NewServer(config))
+}
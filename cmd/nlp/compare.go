@@ -0,0 +1,56 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/srush/nlp-course/nlp"
+)
+
+func runCompare(args []string) int {
+	config := nlp.DefaultSignificanceConfiguration()
+	flags := flag.NewFlagSet("compare", flag.ContinueOnError)
+	gold_name := flags.String("gold", "", "gold corpus (.tag, .conll or .conllu)")
+	a_name := flags.String("a", "", "first tagged corpus")
+	b_name := flags.String("b", "", "second tagged corpus")
+	flags.IntVar(&config.Samples, "samples", config.Samples, "bootstrap resamples and randomization shuffles")
+	flags.Float64Var(&config.Confidence, "confidence", config.Confidence, "confidence interval coverage")
+	flags.Int64Var(&config.Seed, "seed", config.Seed, "random seed")
+	typ := flags.String("type", "text", "report type: text, json or html")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *gold_name == "" || *a_name == "" || *b_name == "" {
+		fmt.Fprintln(os.Stderr, "nlp compare: -gold, -a and -b are required")
+		flags.Usage()
+		return 2
+	}
+
+	gold, err := readCorpusFile(*gold_name)
+	if err != nil {
+		return fail("gold corpus: %s", err)
+	}
+	if gold.NumSentences() == 0 {
+		return fail("corpus check: Gold corpus blank.")
+	}
+	var tests [2]nlp.Corpus
+	for i, name := range []string{*a_name, *b_name} {
+		if tests[i], err = readCorpusFile(name); err != nil {
+			return fail("%s: %s", name, err)
+		}
+		if err := nlp.CheckSameCorpus(gold, tests[i]); err != nil {
+			return fail("corpus check %s: %s", name, err)
+		}
+	}
+
+	significance := nlp.CompareTaggings(gold, tests[0], tests[1], config)
+	significance.GoldName = filepath.Base(*gold_name)
+	significance.AName = filepath.Base(*a_name)
+	significance.BName = filepath.Base(*b_name)
+	if err := nlp.WriteSignificance(os.Stdout, significance, *typ); err != nil {
+		return fail("results: %s", err)
+	}
+	return 0
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/srush/nlp-course/nlp"
+)
+
+func runConvert(args []string) int {
+	flags := flag.NewFlagSet("convert", flag.ContinueOnError)
+	input_name := flags.String("input", "-", "corpus to convert, or - for stdin")
+	from := flags.String("from", "", "input format, if not given by the file extension; tag:SEP or tag:SEP:ESC reads tags with another separator and escape, conllu:xpos reads XPOS as the tag")
+	to := flags.String("to", "", "output format: tag, conll, conllu or txt; tag:SEP or tag:SEP:ESC writes tags with another separator and escape, conllu:xpos writes the tag to XPOS")
+	lossy := flags.Bool("lossy", false, "allow dropping fields the output format cannot represent")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *to == "" || (*input_name == "-" && *from == "") {
+		fmt.Fprintln(os.Stderr, "nlp convert: -to is required, and -from when reading stdin")
+		flags.Usage()
+		return 2
+	}
+	formatter := nlp.Formatter(*to)
+	if !*lossy {
+		input_formatter := nlp.Formatter(inputFormat(*input_name, *from, ""))
+		if err := nlp.CheckFormatConversion(input_formatter, formatter); err != nil {
+			return fail("%s Use -lossy to convert anyway.", err)
+		}
+	}
+	output, err := newStagedOutput()
+	if err != nil {
+		return fail("output: %s", err)
+	}
+	defer output.discard()
+	writer, err := nlp.NewSentenceWriter(output, *to)
+	if err != nil {
+		return fail("output: %s", err)
+	}
+
+	// Convert a sentence at a time into the staged output, which reaches
+	// stdout only if no sentence would lose fields.
+	reader, close, err := openInput(*input_name, *from, "")
+	if err != nil {
+		return fail("input: %s", err)
+	}
+	defer close()
+	for i := 1; ; i++ {
+		sentence, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fail("input: %s", err)
+		}
+		metadata := nlp.ReaderMetadata(reader)
+		if !*lossy {
+			if err := nlp.CheckSentenceConversion(i, sentence, metadata, formatter); err != nil {
+				return fail("%s Use -lossy to convert anyway.", err)
+			}
+		}
+		if err := nlp.WriteWithMetadata(writer, sentence, metadata); err != nil {
+			return fail("output: %s", err)
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		return fail("output: %s", err)
+	}
+	if err := output.commit(); err != nil {
+		return fail("output: %s", err)
+	}
+	return 0
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/srush/nlp-course/nlp"
+)
+
+func runErrors(args []string) int {
+	var filter nlp.ErrorFilter
+	flags := flag.NewFlagSet("errors", flag.ContinueOnError)
+	gold_name := flags.String("gold", "", "gold corpus (.tag, .conll or .conllu)")
+	test_name := flags.String("test", "", "tagged corpus to analyze (.tag, .conll or .conllu)")
+	flags.StringVar(&filter.GoldTag, "gold-tag", "", "only sentences with a mistake on this gold tag")
+	flags.StringVar(&filter.TestTag, "test-tag", "", "only sentences with a mistake predicting this tag")
+	sort := flags.String("sort", "", `"errors" to list sentences with the most errors first`)
+	typ := flags.String("type", "text", "report type: text, json or html")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *gold_name == "" || *test_name == "" {
+		fmt.Fprintln(os.Stderr, "nlp errors: -gold and -test are required")
+		flags.Usage()
+		return 2
+	}
+	filter.SortByErrors = *sort == "errors"
+
+	gold, err := readCorpusFile(*gold_name)
+	if err != nil {
+		return fail("gold corpus: %s", err)
+	}
+	test, err := readCorpusFile(*test_name)
+	if err != nil {
+		return fail("test corpus: %s", err)
+	}
+	if err := nlp.CheckSameCorpus(gold, test); err != nil {
+		return fail("corpus check: %s", err)
+	}
+
+	analysis := nlp.ErrorAnalysis{
+		GoldName:  filepath.Base(*gold_name),
+		TestName:  filepath.Base(*test_name),
+		Filter:    filter,
+		Sentences: nlp.AnalyzeErrors(gold, test, filter),
+	}
+	if err := nlp.WriteErrorAnalysis(os.Stdout, analysis, *typ); err != nil {
+		return fail("results: %s", err)
+	}
+	return 0
+}
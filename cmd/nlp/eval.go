@@ -0,0 +1,74 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/srush/nlp-course/nlp"
+)
+
+func runEval(args []string) int {
+	flags := flag.NewFlagSet("eval", flag.ContinueOnError)
+	gold_name := flags.String("gold", "", "gold corpus (.tag, .conll or .conllu)")
+	test_name := flags.String("test", "", "tagged corpus to score (.tag, .conll or .conllu)")
+	train_name := flags.String("train", "", "training corpus, to break accuracy down by known and unknown words")
+	typ := flags.String("type", "text", "report type: text, json, html or csv")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *gold_name == "" || *test_name == "" {
+		fmt.Fprintln(os.Stderr, "nlp eval: -gold and -test are required")
+		flags.Usage()
+		return 2
+	}
+
+	results := nlp.Results{
+		GoldName: filepath.Base(*gold_name),
+		TestName: filepath.Base(*test_name),
+	}
+	var err error
+	results.Results, err = scoreStream(*gold_name, *test_name, *train_name)
+	if err != nil {
+		return fail("%s", err)
+	}
+	if err := nlp.WriteResults(os.Stdout, results, *typ); err != nil {
+		return fail("results: %s", err)
+	}
+	return 0
+}
+
+// Score the test file against the gold file a sentence at a time. If a
+// training file is given, accuracy is also broken down by its words, and
+// only those words are kept in memory.
+func scoreStream(gold_name string, test_name string, train_name string) (results nlp.TaggingResults, err error) {
+	gold, close_gold, err := openInput(gold_name, "", "")
+	if err != nil {
+		return results, fmt.Errorf("gold corpus: %s", err)
+	}
+	defer close_gold()
+	test, close_test, err := openInput(test_name, "", "")
+	if err != nil {
+		return results, fmt.Errorf("test corpus: %s", err)
+	}
+	defer close_test()
+	if train_name == "" {
+		results, err = nlp.ScoreTaggingStream(gold, test)
+	} else {
+		var train nlp.SentenceReader
+		var close_train func()
+		if train, close_train, err = openInput(train_name, "", ""); err != nil {
+			return results, fmt.Errorf("training corpus: %s", err)
+		}
+		defer close_train()
+		results, err = nlp.ScoreTaggingStreamWithTraining(gold, test, train)
+	}
+	if err != nil {
+		return results, fmt.Errorf("corpus check: %s", err)
+	}
+	if results.SentencesResult.Total == 0 {
+		return results, fmt.Errorf("corpus check: Gold corpus blank.")
+	}
+	return results, nil
+}
@@ -0,0 +1,133 @@
+// Command nlp trains and runs HMM taggers, evaluates them offline with the
+// same reports as the course server, and runs that server.
+//
+// Usage:
+//
+//	nlp <command> [flags]
+//
+// Run "nlp <command> -h" for the flags of each command. Commands exit with
+// status 1 when their input cannot be read or scored, and 2 on bad usage.
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/srush/nlp-course/nlp"
+)
+
+type command struct {
+	name  string
+	usage string
+	run   func(args []string) int
+}
+
+var commands = []command{
+	{"train", "train an HMM tagger and write a model file", runTrain},
+	{"tag", "tag a corpus with a trained model", runTag},
+	{"eval", "score a tagged file against a gold file", runEval},
+	{"compare", "test whether two tagged files differ significantly", runCompare},
+	{"errors", "list the incorrectly tagged sentences of a tagged file", runErrors},
+	{"convert", "convert a corpus between formats", runConvert},
+	{"serve", "run the evaluation server", runServe},
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: nlp <command> [flags]\n\ncommands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-8s %s\n", cmd.name, cmd.usage)
+	}
+}
+
+func fail(format string, args ...interface{}) int {
+	fmt.Fprintf(os.Stderr, "nlp: "+format+"\n", args...)
+	return 1
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	for _, cmd := range commands {
+		if cmd.name == os.Args[1] {
+			os.Exit(cmd.run(os.Args[2:]))
+		}
+	}
+	fmt.Fprintf(os.Stderr, "nlp: unknown command %q\n", os.Args[1])
+	usage()
+	os.Exit(2)
+}
+
+func readCorpusFile(file_name string) (nlp.Corpus, error) {
+	file, err := os.Open(file_name)
+	if err != nil {
+		return nlp.Corpus{}, err
+	}
+	defer file.Close()
+	return nlp.ReadCorpus(file, file_name)
+}
+
+// Open a corpus file or, for "-", stdin, for reading a sentence at a time.
+// The format comes from format if set, then the file extension, then
+// default_format for stdin. The returned function closes the file.
+// The format of an input: format if given, and otherwise the file
+// extension, or default_format for stdin.
+func inputFormat(file_name string, format string, default_format string) string {
+	switch {
+	case format != "":
+		return format
+	case file_name != "-":
+		return strings.TrimPrefix(filepath.Ext(file_name), ".")
+	}
+	return default_format
+}
+
+func openInput(file_name string, format string, default_format string) (nlp.SentenceReader, func(), error) {
+	var reader io.Reader = os.Stdin
+	close := func() {}
+	if file_name != "-" {
+		file, err := os.Open(file_name)
+		if err != nil {
+			return nil, nil, err
+		}
+		reader = file
+		close = func() { file.Close() }
+	}
+	sentences, err := nlp.NewSentenceReader(reader, inputFormat(file_name, format, default_format))
+	if err != nil {
+		close()
+		return nil, nil, err
+	}
+	return sentences, close, nil
+}
+
+// Output held in a temporary file until the command succeeds, so that a
+// command that fails part way writes nothing to stdout.
+type stagedOutput struct {
+	*os.File
+}
+
+func newStagedOutput() (stagedOutput, error) {
+	file, err := ioutil.TempFile("", "nlp-output")
+	return stagedOutput{file}, err
+}
+
+// Copy the output to stdout.
+func (output stagedOutput) commit() error {
+	if _, err := output.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	_, err := io.Copy(os.Stdout, output)
+	return err
+}
+
+// Remove the temporary file, whether or not the output was committed.
+func (output stagedOutput) discard() {
+	output.Close()
+	os.Remove(output.Name())
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/srush/nlp-course/server"
+)
+
+func runServe(args []string) int {
+	flags := flag.NewFlagSet("serve", flag.ContinueOnError)
+	addr := flags.String("addr", ":8080", "address to listen on")
+	static := flags.String("static", "static", "directory served under /static/")
+	gold_dir := flags.String("gold", "", "directory of named gold corpora; those under hidden/ are hidden")
+	store_path := flags.String("store", "", "file to record submissions in for the leaderboard")
+	var deadlines deadlineFlag
+	flags.Var(&deadlines, "deadline", "gold=RFC3339 time after which submissions for gold are rejected (repeatable)")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	config := server.Config{StaticDir: *static, Deadlines: deadlines}
+	if *store_path != "" {
+		store, err := server.OpenFileStore(*store_path)
+		if err != nil {
+			return fail("store: %s", err)
+		}
+		config.Store = store
+	}
+	if *gold_dir != "" {
+		gold, err := server.LoadGoldCorpora(*gold_dir)
+		if err != nil {
+			return fail("gold corpora: %s", err)
+		}
+		for name, corpus := range gold {
+			log.Printf("Gold corpus %s: %d sentences, hidden %t", name, corpus.Corpus.NumSentences(), corpus.Hidden)
+		}
+		config.Gold = gold
+	}
+	handler := server.NewServer(config)
+	log.Printf("Listening on %s", *addr)
+	if err := http.ListenAndServe(*addr, handler); err != nil {
+		return fail("serve: %s", err)
+	}
+	return 0
+}
+
+// Collects repeated -deadline gold=time flags.
+type deadlineFlag map[string]time.Time
+
+func (deadlines deadlineFlag) String() string {
+	var parts []string
+	for gold, deadline := range deadlines {
+		parts = append(parts, gold+"="+deadline.Format(time.RFC3339))
+	}
+	return strings.Join(parts, ",")
+}
+
+func (deadlines *deadlineFlag) Set(value string) error {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 {
+		return fmt.Errorf("expected gold=time, got %q", value)
+	}
+	deadline, err := time.Parse(time.RFC3339, parts[1])
+	if err != nil {
+		return err
+	}
+	if *deadlines == nil {
+		*deadlines = make(deadlineFlag)
+	}
+	(*deadlines)[parts[0]] = deadline
+	return nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/srush/nlp-course/nlp"
+)
+
+func runTag(args []string) int {
+	flags := flag.NewFlagSet("tag", flag.ContinueOnError)
+	model_name := flags.String("model", "", "model file written by nlp train")
+	input_name := flags.String("input", "-", "corpus to tag (.txt, .tag, .conll or .conllu), or - for stdin")
+	input_format := flags.String("format", "", "input format, if not given by the file extension; tag:SEP or tag:SEP:ESC reads tags with another separator and escape")
+	output_format := flags.String("output-format", "tag", "output format: tag, conll, conllu or txt; tag:SEP or tag:SEP:ESC writes tags with another separator and escape")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *model_name == "" {
+		fmt.Fprintln(os.Stderr, "nlp tag: -model is required")
+		flags.Usage()
+		return 2
+	}
+	output, err := newStagedOutput()
+	if err != nil {
+		return fail("output: %s", err)
+	}
+	defer output.discard()
+	writer, err := nlp.NewSentenceWriter(output, *output_format)
+	if err != nil {
+		return fail("output: %s", err)
+	}
+
+	model, err := os.Open(*model_name)
+	if err != nil {
+		return fail("model: %s", err)
+	}
+	tagger, err := nlp.ReadModel(model)
+	model.Close()
+	if err != nil {
+		return fail("model: %s", err)
+	}
+
+	// Tag a sentence at a time so that corpora of any size fit in memory.
+	// Output is staged on disk and reaches stdout only if every sentence is
+	// tagged.
+	reader, close, err := openInput(*input_name, *input_format, "txt")
+	if err != nil {
+		return fail("input: %s", err)
+	}
+	defer close()
+	for i := 1; ; i++ {
+		sentence, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fail("input: %s", err)
+		}
+		tagged, _, err := tagger.Tag(sentence)
+		if err != nil {
+			return fail("tagging: Sentence %d: %s", i, err)
+		}
+		if err := nlp.WriteWithMetadata(writer, tagged, nlp.ReaderMetadata(reader)); err != nil {
+			return fail("output: %s", err)
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		return fail("output: %s", err)
+	}
+	if err := output.commit(); err != nil {
+		return fail("output: %s", err)
+	}
+	return 0
+}
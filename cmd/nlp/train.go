@@ -0,0 +1,75 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/srush/nlp-course/nlp"
+)
+
+func runTrain(args []string) int {
+	flags := flag.NewFlagSet("train", flag.ContinueOnError)
+	train_name := flags.String("train", "", "tagged training corpus (.tag, .conll or .conllu)")
+	model_name := flags.String("model", "", "model file to write")
+	order := flags.Int("order", 1, "number of previous tags each transition conditions on")
+	start := flags.String("start", "", "estimator for the start distribution (default: -transition)")
+	transition := flags.String("transition", "witten-bell", "estimator for transitions")
+	emission := flags.String("emission", "add-k:0.01", "estimator for emissions")
+	unknown := flags.Int("unknown", 0, "replace words seen fewer times than this with UNK classes")
+	signatures := flags.Bool("signatures", false, "use word signatures as UNK classes")
+	dictionary := flags.Int("dictionary", -1, "prune decoding with a tag dictionary: words seen at least this many times keep only their training tags (-1 disables; 0 or 1 restricts every training word)")
+	binary := flags.Bool("binary", false, "write the compact binary model format instead of JSON")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *train_name == "" || *model_name == "" {
+		fmt.Fprintln(os.Stderr, "nlp train: -train and -model are required")
+		flags.Usage()
+		return 2
+	}
+	if *start == "" {
+		*start = *transition
+	}
+
+	var estimators nlp.HMMEstimators
+	var err error
+	if estimators.Start, err = nlp.ParseEstimator(*start); err != nil {
+		return fail("%s", err)
+	}
+	if estimators.Transition, err = nlp.ParseEstimator(*transition); err != nil {
+		return fail("%s", err)
+	}
+	if estimators.Emission, err = nlp.ParseEstimator(*emission); err != nil {
+		return fail("%s", err)
+	}
+	config := nlp.DefaultHmmConfiguration().
+		WithOrder(*order).
+		WithUnknownWords(*unknown, *signatures).
+		WithEstimators(estimators)
+	if *dictionary >= 0 {
+		config = config.WithTagDictionary(*dictionary)
+	}
+
+	corpus, err := readCorpusFile(*train_name)
+	if err != nil {
+		return fail("training corpus: %s", err)
+	}
+	if err := config.CheckSize(corpus); err != nil {
+		return fail("%s", err)
+	}
+	tagger := nlp.EstimateFromCorpus(corpus, config)
+
+	file, err := os.Create(*model_name)
+	if err != nil {
+		return fail("model: %s", err)
+	}
+	if err := nlp.WriteModel(file, tagger, *binary); err != nil {
+		file.Close()
+		return fail("model: %s", err)
+	}
+	if err := file.Close(); err != nil {
+		return fail("model: %s", err)
+	}
+	return 0
+}
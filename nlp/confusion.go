@@ -0,0 +1,162 @@
+package nlp
+
+import (
+	"sort"
+)
+
+// How often each gold tag was tagged as each test tag, keyed by tag string
+// since the gold and test lexicons assign their own ids.
+type ConfusionMatrix map[string]map[string]int
+
+func (matrix ConfusionMatrix) Inc(gold string, test string) {
+	row, ok := matrix[gold]
+	if !ok {
+		row = make(map[string]int)
+		matrix[gold] = row
+	}
+	row[test]++
+}
+
+func (matrix ConfusionMatrix) Count(gold string, test string) int {
+	return matrix[gold][test]
+}
+
+// Every tag seen in either the gold or the test corpus, sorted.
+func (matrix ConfusionMatrix) Tags() []string {
+	seen := make(map[string]bool)
+	for gold, row := range matrix {
+		seen[gold] = true
+		for test := range row {
+			seen[test] = true
+		}
+	}
+	tags := make([]string, 0, len(seen))
+	for tag := range seen {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// One row of the matrix, with a count for each of Tags().
+type ConfusionRow struct {
+	Gold   string
+	Counts []int
+}
+
+func (matrix ConfusionMatrix) Rows() []ConfusionRow {
+	tags := matrix.Tags()
+	rows := make([]ConfusionRow, len(tags))
+	for i, gold := range tags {
+		rows[i].Gold = gold
+		rows[i].Counts = make([]int, len(tags))
+		for j, test := range tags {
+			rows[i].Counts[j] = matrix.Count(gold, test)
+		}
+	}
+	return rows
+}
+
+type Confusion struct {
+	Gold  string
+	Test  string
+	Count int
+}
+
+// The n most frequent off-diagonal entries, most frequent first.
+func (matrix ConfusionMatrix) TopConfusions(n int) []Confusion {
+	var confusions []Confusion
+	for gold, row := range matrix {
+		for test, count := range row {
+			if gold != test && count > 0 {
+				confusions = append(confusions, Confusion{gold, test, count})
+			}
+		}
+	}
+	sort.Slice(confusions, func(i, j int) bool {
+		if confusions[i].Count != confusions[j].Count {
+			return confusions[i].Count > confusions[j].Count
+		}
+		if confusions[i].Gold != confusions[j].Gold {
+			return confusions[i].Gold < confusions[j].Gold
+		}
+		return confusions[i].Test < confusions[j].Test
+	})
+	if len(confusions) > n {
+		confusions = confusions[:n]
+	}
+	return confusions
+}
+
+// Precision, recall and F1 for one tag, or averaged over tags. Gold is the
+// number of tokens with the tag in the gold corpus and Predicted the number
+// in the test corpus. A score with a zero denominator is zero.
+type PRFResult struct {
+	Name      string
+	Correct   int
+	Gold      int
+	Predicted int
+	Precision float64
+	Recall    float64
+	F1        float64
+}
+
+func ratio(numerator int, denominator int) float64 {
+	if denominator == 0 {
+		return 0
+	}
+	return float64(numerator) / float64(denominator)
+}
+
+func (result *PRFResult) score() {
+	result.Precision = ratio(result.Correct, result.Predicted)
+	result.Recall = ratio(result.Correct, result.Gold)
+	if result.Precision+result.Recall > 0 {
+		result.F1 = 2 * result.Precision * result.Recall / (result.Precision + result.Recall)
+	}
+}
+
+// Score each of tags, then the micro average, pooling counts over all
+// tags, and the macro average, the mean of the per-tag scores.
+func (matrix ConfusionMatrix) PRF(tags []string) (scores []PRFResult, micro PRFResult, macro PRFResult) {
+	scores = make([]PRFResult, len(tags))
+	index := make(map[string]int)
+	for i, tag := range tags {
+		scores[i].Name = tag
+		index[tag] = i
+	}
+	for gold, row := range matrix {
+		for test, count := range row {
+			if i, ok := index[gold]; ok {
+				scores[i].Gold += count
+			}
+			if i, ok := index[test]; ok {
+				scores[i].Predicted += count
+			}
+			if gold == test {
+				if i, ok := index[gold]; ok {
+					scores[i].Correct += count
+				}
+			}
+		}
+	}
+	micro.Name = "micro"
+	macro.Name = "macro"
+	for i := range scores {
+		scores[i].score()
+		micro.Correct += scores[i].Correct
+		micro.Gold += scores[i].Gold
+		micro.Predicted += scores[i].Predicted
+		macro.Precision += scores[i].Precision
+		macro.Recall += scores[i].Recall
+		macro.F1 += scores[i].F1
+	}
+	micro.score()
+	if len(scores) > 0 {
+		macro.Correct, macro.Gold, macro.Predicted = micro.Correct, micro.Gold, micro.Predicted
+		macro.Precision /= float64(len(scores))
+		macro.Recall /= float64(len(scores))
+		macro.F1 /= float64(len(scores))
+	}
+	return
+}
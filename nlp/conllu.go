@@ -0,0 +1,306 @@
+package nlp
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// The CoNLL-U format of Universal Dependencies. UPOS is read as the tag and
+// XPOS as the category, or the other way round for the format named
+// "conllu:xpos". Comments, multiword token ranges and empty nodes are kept
+// in the sentence metadata, so files round-trip exactly.
+//
+// The tag is what taggers predict and scoring compares. CoNLL-X keeps its
+// tag in the fine-grained POSTAG column, which matches XPOS rather than
+// UPOS, so CheckFormatConversion refuses conversions between CoNLL-X and
+// CoNLL-U read with UPOS as the tag.
+type CoNLLUFormat struct {
+	xpos bool
+}
+
+func conlluFormatFromSpec(spec string) CorpusFormatter {
+	switch spec {
+	case "upos":
+		return CoNLLUFormat{}
+	case "xpos":
+		return CoNLLUFormat{xpos: true}
+	}
+	return nil
+}
+
+// The token with its tag and category exchanged if this format reads XPOS
+// as the tag, so that the tag is always UPOS.
+func (format CoNLLUFormat) uposTag(token Token) Token {
+	if format.xpos {
+		token.tag, token.category = token.category, token.tag
+	}
+	return token
+}
+
+var conlluColumns = []string{"ID", "FORM", "LEMMA", "UPOS", "XPOS", "FEATS", "HEAD", "DEPREL", "DEPS", "MISC"}
+
+// A line of a CoNLL-U sentence that is not a regular token, placed before
+// the token at position.
+type extraLine struct {
+	position int
+	line     string
+}
+
+// What a CoNLL-U sentence holds besides its tokens.
+type SentenceMetadata struct {
+	comments []string
+	extras   []extraLine
+}
+
+func (metadata SentenceMetadata) empty() bool {
+	return len(metadata.comments) == 0 && len(metadata.extras) == 0
+}
+
+// The sentence's comment lines, without the leading #.
+func (metadata SentenceMetadata) Comments() []string {
+	comments := make([]string, len(metadata.comments))
+	for i, comment := range metadata.comments {
+		comments[i] = strings.TrimSpace(strings.TrimPrefix(comment, "#"))
+	}
+	return comments
+}
+
+// The value of a "# key = value" comment, such as sent_id or text.
+func (metadata SentenceMetadata) Value(key string) (string, bool) {
+	for _, comment := range metadata.Comments() {
+		parts := strings.SplitN(comment, "=", 2)
+		if len(parts) == 2 && strings.TrimSpace(parts[0]) == key {
+			return strings.TrimSpace(parts[1]), true
+		}
+	}
+	return "", false
+}
+
+// A multiword token spanning the tokens First to Last, counting from 1.
+type MultiwordToken struct {
+	First int
+	Last  int
+	Form  string
+}
+
+func (metadata SentenceMetadata) MultiwordTokens() (tokens []MultiwordToken) {
+	for _, extra := range metadata.extras {
+		fields := strings.Split(extra.line, "\t")
+		var token MultiwordToken
+		if _, err := fmt.Sscanf(fields[0], "%d-%d", &token.First, &token.Last); err == nil {
+			token.Form = fields[1]
+			tokens = append(tokens, token)
+		}
+	}
+	return
+}
+
+// The metadata of sentence i, empty if the corpus format has none.
+func (corpus Corpus) Metadata(i int) SentenceMetadata {
+	if i < len(corpus.metadata) {
+		return corpus.metadata[i]
+	}
+	return SentenceMetadata{}
+}
+
+// The FEATS column as a map from feature to value.
+func (token Token) Features() map[string]string {
+	features := make(map[string]string)
+	if token.feats == "" {
+		return features
+	}
+	for _, feature := range strings.Split(token.feats, "|") {
+		parts := strings.SplitN(feature, "=", 2)
+		if len(parts) == 2 {
+			features[parts[0]] = parts[1]
+		}
+	}
+	return features
+}
+
+func (token Token) ToCoNLLUString() string {
+	return strings.Join([]string{
+		strconv.Itoa(token.index),
+		token.word,
+		conllField(token.lemma),
+		conllField(token.tag),
+		conllField(token.category),
+		conllField(token.feats),
+		conllHead(token),
+		conllField(token.label),
+		conllField(token.deps),
+		conllField(token.misc),
+	}, "\t")
+}
+
+// Check the ID of a multiword token range (1-2) or empty node (8.1).
+func checkExtraId(id string, position int) error {
+	var first, second int
+	if strings.Contains(id, "-") {
+		if _, err := fmt.Sscanf(id, "%d-%d", &first, &second); err != nil || first != position+1 || second < first {
+			return columnError(conlluColumns, 0, "bad multiword token range %q", id)
+		}
+		return nil
+	}
+	if _, err := fmt.Sscanf(id, "%d.%d", &first, &second); err != nil || first != position || second < 1 {
+		return columnError(conlluColumns, 0, "bad empty node %q", id)
+	}
+	return nil
+}
+
+func (format CoNLLUFormat) readToken(fields []string, lexicon *Lexicon) (token Token, err error) {
+	if token.index, err = strconv.Atoi(fields[0]); err != nil || token.index < 1 {
+		return token, columnError(conlluColumns, 0, "expected a positive integer, found %q", fields[0])
+	}
+	if fields[6] != "_" {
+		if token.head_index, err = strconv.Atoi(fields[6]); err != nil || token.head_index < 0 {
+			return token, columnError(conlluColumns, 6, "expected a head index, found %q", fields[6])
+		}
+		token.has_head = true
+	}
+	token.word = fields[1]
+	token.lemma = conllValue(fields[2])
+	token.tag = conllValue(fields[3])
+	token.category = conllValue(fields[4])
+	token.feats = conllValue(fields[5])
+	token.label = conllValue(fields[7])
+	token.deps = conllValue(fields[8])
+	token.misc = conllValue(fields[9])
+	token = format.uposTag(token)
+	token.tag_id = lexicon.tags.UpdateTypeMap(token.tag)
+	token.word_id = lexicon.words.UpdateTypeMap(token.word)
+	token.label_id = lexicon.labels.UpdateTypeMap(token.label)
+	return
+}
+
+type conlluSentenceReader struct {
+	format   CoNLLUFormat
+	lines    *lineReader
+	lexicon  *Lexicon
+	metadata SentenceMetadata
+}
+
+// Read sentences separated by blank lines. Comments must come before a
+// sentence's first token line. Malformed lines give a ParseError naming the
+// line and column.
+func (format CoNLLUFormat) NewSentenceReader(reader io.Reader) SentenceReader {
+	return &conlluSentenceReader{format: format, lines: newLineReader(reader), lexicon: NewLexicon()}
+}
+
+func (reader *conlluSentenceReader) Lexicon() *Lexicon {
+	return reader.lexicon
+}
+
+func (reader *conlluSentenceReader) Metadata() SentenceMetadata {
+	return reader.metadata
+}
+
+func (reader *conlluSentenceReader) Next() (Sentence, error) {
+	var sentence Sentence
+	var metadata SentenceMetadata
+	started := false
+	for {
+		line, err := reader.lines.next()
+		if err == io.EOF && started {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := reader.format.readLine(line, reader.lexicon, &sentence, &metadata, &started); err != nil {
+			return nil, lineError(reader.lines.line_number, err)
+		}
+		if strings.TrimSpace(line) == "" && started {
+			break
+		}
+	}
+	reader.metadata = metadata
+	return sentence, nil
+}
+
+func (format CoNLLUFormat) ReadCorpus(reader io.Reader) (corpus Corpus, err error) {
+	return ReadAll(format.NewSentenceReader(reader))
+}
+
+func (format CoNLLUFormat) readLine(line string, lexicon *Lexicon, sentence *Sentence, metadata *SentenceMetadata, started *bool) error {
+	switch {
+	case strings.TrimSpace(line) == "":
+		return nil
+	case strings.HasPrefix(line, "#"):
+		if len(*sentence) > 0 || len(metadata.extras) > 0 {
+			return ParseError{error: "comment inside a sentence"}
+		}
+		metadata.comments = append(metadata.comments, line)
+		*started = true
+		return nil
+	}
+	*started = true
+	fields := strings.Split(line, "\t")
+	if len(fields) != len(conlluColumns) {
+		return ParseError{error: fmt.Sprintf("expected %d tab-separated columns, found %d", len(conlluColumns), len(fields))}
+	}
+	for i, field := range fields {
+		if field == "" {
+			return columnError(conlluColumns, i, "empty field")
+		}
+	}
+	if strings.ContainsAny(fields[0], "-.") {
+		if err := checkExtraId(fields[0], len(*sentence)); err != nil {
+			return err
+		}
+		metadata.extras = append(metadata.extras, extraLine{len(*sentence), line})
+		return nil
+	}
+	token, err := format.readToken(fields, lexicon)
+	if err != nil {
+		return err
+	}
+	if token.index != len(*sentence)+1 {
+		return columnError(conlluColumns, 0, "expected token %d, found %d", len(*sentence)+1, token.index)
+	}
+	*sentence = append(*sentence, token)
+	return nil
+}
+
+func (format CoNLLUFormat) formatSentence(sentence Sentence, metadata SentenceMetadata) string {
+	var out bytes.Buffer
+	for _, comment := range metadata.comments {
+		fmt.Fprintf(&out, "%s\n", comment)
+	}
+	extras := metadata.extras
+	for j, token := range sentence {
+		for len(extras) > 0 && extras[0].position <= j {
+			fmt.Fprintf(&out, "%s\n", extras[0].line)
+			extras = extras[1:]
+		}
+		fmt.Fprintf(&out, "%s\n", format.uposTag(token).ToCoNLLUString())
+	}
+	for _, extra := range extras {
+		fmt.Fprintf(&out, "%s\n", extra.line)
+	}
+	out.WriteString("\n")
+	return out.String()
+}
+
+type conlluSentenceWriter struct {
+	lineWriter
+	format CoNLLUFormat
+}
+
+func (format CoNLLUFormat) NewSentenceWriter(writer io.Writer) SentenceWriter {
+	return conlluSentenceWriter{newLineWriter(writer, func(sentence Sentence) string {
+		return format.formatSentence(sentence, SentenceMetadata{})
+	}), format}
+}
+
+func (writer conlluSentenceWriter) WriteWithMetadata(sentence Sentence, metadata SentenceMetadata) error {
+	_, err := writer.writer.WriteString(writer.format.formatSentence(sentence, metadata))
+	return err
+}
+
+func (format CoNLLUFormat) FormatCorpus(corpus Corpus, writer io.Writer) {
+	WriteAll(format.NewSentenceWriter(writer), corpus)
+}
@@ -0,0 +1,126 @@
+package nlp
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+const conllu_data = `# sent_id = 1
+# text = Vámonos al mar.
+1-2	Vámonos	_	_	_	_	_	_	_	_
+1	Vamos	ir	VERB	_	Mood=Imp|Number=Plur|Person=1	0	root	_	_
+2	nos	nosotros	PRON	_	Case=Acc|Number=Plur|Person=1	1	obj	_	_
+3-4	al	_	_	_	_	_	_	_	_
+3	a	a	ADP	_	_	5	case	_	_
+4	el	el	DET	_	Definite=Def|Gender=Masc	5	det	_	_
+5	mar	mar	NOUN	_	Gender=Masc|Number=Sing	1	obl	_	SpaceAfter=No
+5.1	ido	ir	VERB	_	_	_	_	1:conj	_
+6	.	.	PUNCT	_	_	1	punct	_	_
+
+# sent_id = 2
+1	Hola	hola	INTJ	UH	_	_	_	_	_
+2	!	!	PUNCT	.	_	0	_	_	_
+
+`
+
+func Test_CoNLLURoundTrip(t *testing.T) {
+	corpus, err := ReadCorpus(strings.NewReader(conllu_data), "es.conllu")
+	if err != nil {
+		t.Fatalf("Couldn't parse: %s", err)
+	}
+	if n := corpus.NumSentences(); n != 2 || len(corpus.sentences[0]) != 6 {
+		t.Fatalf("Unexpected sentences: %d", n)
+	}
+	if tag := corpus.lexicon.Tag(corpus.sentences[0][0]); tag != "VERB" {
+		t.Errorf("UPOS not read as tag: %s", tag)
+	}
+	if features := corpus.sentences[0][0].Features(); features["Mood"] != "Imp" || len(features) != 3 {
+		t.Errorf("Features: %v", features)
+	}
+	metadata := corpus.Metadata(0)
+	if text, ok := metadata.Value("text"); !ok || text != "Vámonos al mar." {
+		t.Errorf("Text comment: %q", text)
+	}
+	if mwts := metadata.MultiwordTokens(); len(mwts) != 2 || mwts[1] != (MultiwordToken{3, 4, "al"}) {
+		t.Errorf("Multiword tokens: %v", mwts)
+	}
+
+	var out bytes.Buffer
+	CoNLLUFormat{}.FormatCorpus(corpus, &out)
+	if out.String() != conllu_data {
+		t.Errorf("CoNLL-U round trip failed:\n%s", out.String())
+	}
+
+	if heads := corpus.sentences[1]; heads[0].has_head || !heads[1].has_head {
+		t.Errorf("HEAD read as %v and %v.", heads[0].has_head, heads[1].has_head)
+	}
+	if err := CheckConversion(corpus, CoNLLFormat{}); err == nil {
+		t.Errorf("Conversion to CoNLL-X should lose multiword tokens.")
+	}
+
+	malformed := []struct {
+		data, message string
+		line, column  int
+	}{
+		{"2-3\tab\t_\t_\t_\t_\t_\t_\t_\t_\n2\ta\t_\t_\t_\t_\t_\t_\t_\t_\n", "Line 1, column 1 (ID): bad multiword token range \"2-3\".", 1, 1},
+		{"1\ta\t_\tX\t_\t_\t0\troot\t_\t_\n# late\n", "Line 2, comment inside a sentence.", 2, 0},
+	}
+	for _, c := range malformed {
+		_, err := CoNLLUFormat{}.ReadCorpus(strings.NewReader(c.data))
+		parse_error, ok := err.(ParseError)
+		if !ok || err.Error() != c.message {
+			t.Errorf("Expected %q, got %v", c.message, err)
+		} else if parse_error.Line != c.line || parse_error.Column != c.column {
+			t.Errorf("%q at line %d column %d, expected %d and %d.", c.message,
+				parse_error.Line, parse_error.Column, c.line, c.column)
+		}
+	}
+}
+
+func Test_CoNLLUTagColumn(t *testing.T) {
+	xpos := Formatter("conllu:xpos")
+	if Formatter("conllu:upos") != (CoNLLUFormat{}) || xpos != (CoNLLUFormat{xpos: true}) ||
+		Formatter("conllu:x") != nil {
+		t.Errorf("Wrong CoNLL-U formats: %v %v", Formatter("conllu:upos"), xpos)
+	}
+	if err := CheckFormatConversion(CoNLLUFormat{}, CoNLLFormat{}); err == nil {
+		t.Errorf("UPOS written to POSTAG without an error.")
+	}
+	if err := CheckFormatConversion(CoNLLFormat{}, CoNLLUFormat{}); err == nil {
+		t.Errorf("POSTAG written to UPOS without an error.")
+	}
+	if err := CheckFormatConversion(xpos, CoNLLFormat{}); err != nil {
+		t.Errorf("XPOS to POSTAG failed: %s", err)
+	}
+	if err := CheckFormatConversion(CoNLLFormat{}, xpos); err != nil {
+		t.Errorf("POSTAG to XPOS failed: %s", err)
+	}
+
+	corpus, err := xpos.ReadCorpus(strings.NewReader(conllu_data))
+	if err != nil {
+		t.Fatalf("Couldn't parse: %s", err)
+	}
+	if tag := corpus.lexicon.Tag(corpus.sentences[1][0]); tag != "UH" {
+		t.Errorf("XPOS not read as tag: %s", tag)
+	}
+	var out bytes.Buffer
+	xpos.FormatCorpus(corpus, &out)
+	if out.String() != conllu_data {
+		t.Errorf("CoNLL-U round trip with XPOS tags failed:\n%s", out.String())
+	}
+	fields := strings.Split(corpus.sentences[1][0].ToCoNLLString(), "\t")
+	if fields[3] != "INTJ" || fields[4] != "UH" {
+		t.Errorf("CPOSTAG %s and POSTAG %s, expected UPOS and XPOS.", fields[3], fields[4])
+	}
+
+	conll, err := CoNLLFormat{}.ReadCorpus(strings.NewReader(dep_data))
+	if err != nil {
+		t.Fatalf("Couldn't parse: %s", err)
+	}
+	out.Reset()
+	xpos.FormatCorpus(conll, &out)
+	if fields := strings.Split(out.String(), "\t"); fields[3] != "V" || fields[4] != "VB" {
+		t.Errorf("UPOS %s and XPOS %s, expected CPOSTAG and POSTAG.", fields[3], fields[4])
+	}
+}
@@ -1,37 +1,93 @@
 package nlp
 
+// Counts may be fractional, as with expected counts from EM.
 type MultinomialCounts struct {
-	counts map[int]int
+	counts map[int]float64
 }
 
 func NewCounts() (counts MultinomialCounts) {
-	counts.counts = make(map[int]int)
+	counts.counts = make(map[int]float64)
 	return
 }
 
 func (counts *MultinomialCounts) Inc(key int) {
-	if _, ok := counts.counts[key]; ok {
-		counts.counts[key] = 0
-	}
 	counts.counts[key]++
 }
 
+func (counts *MultinomialCounts) Add(key int, count float64) {
+	counts.counts[key] += count
+}
+
+func (counts MultinomialCounts) Count(key int) float64 {
+	return counts.counts[key]
+}
+
+func (counts MultinomialCounts) Total() (total float64) {
+	for _, count := range counts.counts {
+		total += count
+	}
+	return
+}
+
+// The number of keys with a positive count.
+func (counts MultinomialCounts) Types() (types int) {
+	for _, count := range counts.counts {
+		if count > 0 {
+			types++
+		}
+	}
+	return
+}
+
+// A distribution over the keys 0 to support - 1. Probability not assigned
+// directly in distribution comes from a backoff distribution, scaled by
+// backoff_weight. If interpolated, every key gets backoff mass; otherwise
+// only keys missing from distribution do. A nil backoff is uniform over the
+// support.
 type Multinomial struct {
 	distribution map[int]float64
+	support int
+	backoff *Multinomial
+	backoff_weight float64
+	interpolated bool
+}
+
+// The uniform distribution over support keys.
+func Uniform(support int) Multinomial {
+	return Multinomial{
+		support: support,
+		backoff_weight: 1.0,
+		interpolated: true,
+	}
+}
+
+func (multi Multinomial) Support() int {
+	return multi.support
+}
+
+func (multi Multinomial) backoffProb(key int) float64 {
+	if multi.backoff != nil {
+		return multi.backoff.Prob(key)
+	}
+	if multi.support <= 0 {
+		return 0
+	}
+	return 1.0 / float64(multi.support)
 }
 
 func (multi Multinomial) Prob(key int) float64 {
-	return multi.distribution[key]
+	prob, seen := multi.distribution[key]
+	if multi.backoff_weight == 0 || (seen && !multi.interpolated) {
+		return prob
+	}
+	return prob + multi.backoff_weight * multi.backoffProb(key)
 }
 
 func (counts MultinomialCounts) MaximumLikelihood() (multinomial Multinomial) {
 	multinomial.distribution = make(map[int]float64)
-	sum := 0.0
-	for _, count := range counts.counts {
-		sum += float64(count)
-	}
+	sum := counts.Total()
 	for key, count := range counts.counts {
-		multinomial.distribution[key] = float64(count) / sum
+		multinomial.distribution[key] = count / sum
 	}
 	return
 }
@@ -0,0 +1,170 @@
+package nlp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	htemplate "html/template"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// One token of a sentence with its gold and predicted tags.
+type TokenDiff struct {
+	Word    string
+	Gold    string
+	Test    string
+	Correct bool
+}
+
+// An incorrectly tagged sentence. Index counts from 1.
+type SentenceErrors struct {
+	Index  int
+	Errors int
+	Tokens []TokenDiff
+}
+
+// Which incorrect sentences to list. If GoldTag or TestTag is set, only
+// sentences with a mistake on a token with that gold or predicted tag are
+// kept. Sentences are in corpus order unless SortByErrors is set.
+type ErrorFilter struct {
+	GoldTag      string
+	TestTag      string
+	SortByErrors bool
+}
+
+func (filter ErrorFilter) keep(token TokenDiff) bool {
+	return !token.Correct &&
+		(filter.GoldTag == "" || token.Gold == filter.GoldTag) &&
+		(filter.TestTag == "" || token.Test == filter.TestTag)
+}
+
+// The incorrectly tagged sentences of test, aligned token by token with
+// gold. The corpora should already have passed CheckSameCorpus.
+func AnalyzeErrors(gold Corpus, test Corpus, filter ErrorFilter) (sentences []SentenceErrors) {
+	for i, test_sentence := range test.sentences {
+		gold_sentence := gold.sentences[i]
+		analysis := SentenceErrors{Index: i + 1, Tokens: make([]TokenDiff, len(test_sentence))}
+		kept := false
+		for j, test_token := range test_sentence {
+			token := TokenDiff{
+				Word: gold_sentence[j].word,
+				Gold: gold.lexicon.GetTag(gold_sentence[j].tag_id),
+				Test: test.lexicon.GetTag(test_token.tag_id),
+			}
+			token.Correct = token.Gold == token.Test
+			if !token.Correct {
+				analysis.Errors++
+			}
+			if filter.keep(token) {
+				kept = true
+			}
+			analysis.Tokens[j] = token
+		}
+		if kept {
+			sentences = append(sentences, analysis)
+		}
+	}
+	if filter.SortByErrors {
+		sort.SliceStable(sentences, func(i, j int) bool {
+			return sentences[i].Errors > sentences[j].Errors
+		})
+	}
+	return
+}
+
+type ErrorAnalysis struct {
+	GoldName  string
+	TestName  string
+	Filter    ErrorFilter
+	Sentences []SentenceErrors
+}
+
+// Write an error analysis as "json", "html" or, for any other type, text
+// with the words, gold and predicted tags of each sentence in aligned rows.
+func WriteErrorAnalysis(writer io.Writer, analysis ErrorAnalysis, typ string) error {
+	switch typ {
+	case "json":
+		b, err := json.Marshal(analysis)
+		if err != nil {
+			return err
+		}
+		_, err = writer.Write(b)
+		return err
+	case "html":
+		return errorAnalysisTemplate.Execute(writer, analysis)
+	}
+	return writeErrorAnalysisText(writer, analysis)
+}
+
+func writeErrorAnalysisText(writer io.Writer, analysis ErrorAnalysis) error {
+	fmt.Fprintf(writer, "Error Analysis\n\nTest file: %s\nGold file: %s\n", analysis.TestName, analysis.GoldName)
+	if analysis.Filter.GoldTag != "" {
+		fmt.Fprintf(writer, "Gold tag:  %s\n", analysis.Filter.GoldTag)
+	}
+	if analysis.Filter.TestTag != "" {
+		fmt.Fprintf(writer, "Test tag:  %s\n", analysis.Filter.TestTag)
+	}
+	fmt.Fprintf(writer, "Sentences: %d\n", len(analysis.Sentences))
+	for _, sentence := range analysis.Sentences {
+		fmt.Fprintf(writer, "\nSentence %d: %d errors\n", sentence.Index, sentence.Errors)
+		rows := [4][]string{{"word"}, {"gold"}, {"test"}, {""}}
+		for _, token := range sentence.Tokens {
+			rows[0] = append(rows[0], token.Word)
+			rows[1] = append(rows[1], token.Gold)
+			rows[2] = append(rows[2], token.Test)
+			mark := ""
+			if !token.Correct {
+				mark = "^"
+			}
+			rows[3] = append(rows[3], mark)
+		}
+		var aligned bytes.Buffer
+		tab_writer := tabwriter.NewWriter(&aligned, 0, 0, 1, ' ', 0)
+		for _, row := range rows {
+			fmt.Fprintf(tab_writer, "%s\n", strings.Join(row, "\t"))
+		}
+		tab_writer.Flush()
+		for _, line := range strings.SplitAfter(aligned.String(), "\n") {
+			if line != "" {
+				if _, err := io.WriteString(writer, strings.TrimRight(line, " \n")+"\n"); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+const errorAnalysisHtml = `
+<html>
+<title>
+</title>
+<style>
+.error { color: red; font-weight: bold; }
+td { padding-right: 0.5em; }
+</style>
+<body>
+Error Analysis
+
+Gold File: {{.GoldName}}
+Test File: {{.TestName}}
+{{with .Filter.GoldTag}}Gold Tag: {{.}}{{end}}
+{{with .Filter.TestTag}}Test Tag: {{.}}{{end}}
+
+Sentences: {{len .Sentences}}
+{{range .Sentences}}
+<h4>Sentence {{.Index}}: {{.Errors}} errors</h4>
+<table>
+<tr><th>word</th>{{range .Tokens}}<td{{if not .Correct}} class="error"{{end}}>{{.Word}}</td>{{end}}</tr>
+<tr><th>gold</th>{{range .Tokens}}<td{{if not .Correct}} class="error"{{end}}>{{.Gold}}</td>{{end}}</tr>
+<tr><th>test</th>{{range .Tokens}}<td{{if not .Correct}} class="error"{{end}}>{{.Test}}</td>{{end}}</tr>
+</table>
+{{end}}
+</body>
+</html>
+`
+
+var errorAnalysisTemplate = htemplate.Must(htemplate.New("error_analysis").Parse(errorAnalysisHtml))
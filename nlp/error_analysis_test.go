@@ -0,0 +1,40 @@
+package nlp
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func Test_AnalyzeErrors(t *testing.T) {
+	gold, _ := TagFormat{}.ReadCorpus(strings.NewReader(
+		"The/DT boy/N walked/V ./.\nA/DT dog/N ran/V ./.\nIt/PRP rained/V ./.\n"))
+	test, _ := TagFormat{}.ReadCorpus(strings.NewReader(
+		"The/DT boy/N walked/N ./.\nA/N dog/V ran/V ./.\nIt/PRP rained/V ./.\n"))
+
+	sentences := AnalyzeErrors(gold, test, ErrorFilter{})
+	if len(sentences) != 2 || sentences[0].Index != 1 || sentences[1].Errors != 2 {
+		t.Fatalf("Unexpected errors: %+v", sentences)
+	}
+	if token := sentences[0].Tokens[2]; token.Word != "walked" || token.Gold != "V" || token.Test != "N" || token.Correct {
+		t.Errorf("Unexpected token: %+v", token)
+	}
+	if sentences := AnalyzeErrors(gold, test, ErrorFilter{SortByErrors: true}); sentences[0].Index != 2 {
+		t.Errorf("Not sorted by errors: %+v", sentences)
+	}
+	if sentences := AnalyzeErrors(gold, test, ErrorFilter{GoldTag: "V"}); len(sentences) != 1 || sentences[0].Index != 1 {
+		t.Errorf("Gold tag filter: %+v", sentences)
+	}
+	if sentences := AnalyzeErrors(gold, test, ErrorFilter{TestTag: "N"}); len(sentences) != 2 {
+		t.Errorf("Test tag filter: %+v", sentences)
+	}
+
+	var out bytes.Buffer
+	analysis := ErrorAnalysis{GoldName: "gold.tag", TestName: "test.tag", Sentences: sentences}
+	if err := WriteErrorAnalysis(&out, analysis, "text"); err != nil {
+		t.Fatalf("Couldn't write: %s", err)
+	}
+	if !strings.Contains(out.String(), "word The boy walked .\ngold DT  N   V      .\ntest DT  N   N      .\n             ^\n") {
+		t.Errorf("Tags not aligned:\n%s", out.String())
+	}
+}
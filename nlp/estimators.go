@@ -0,0 +1,278 @@
+package nlp
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// An Estimator turns counts into a Multinomial. Smoothing estimators move
+// probability onto the backoff distribution, which also fixes the support.
+type Estimator interface {
+	Estimate(counts MultinomialCounts, backoff Multinomial) Multinomial
+}
+
+func backoffPointer(backoff Multinomial) *Multinomial {
+	if backoff.distribution == nil && backoff.backoff == nil {
+		// Uniform backoffs are implied by the support.
+		return nil
+	}
+	return &backoff
+}
+
+// Relative frequency, with no mass for unseen keys.
+type MaximumLikelihoodEstimator struct {}
+
+func (estimator MaximumLikelihoodEstimator) Estimate(counts MultinomialCounts, backoff Multinomial) Multinomial {
+	multinomial := counts.MaximumLikelihood()
+	multinomial.support = backoff.support
+	return multinomial
+}
+
+// Add K pseudo-counts spread over the support in proportion to the backoff
+// distribution. With a uniform backoff and K = 1 this is Laplace smoothing.
+type AddKEstimator struct {
+	K float64
+}
+
+func (estimator AddKEstimator) Estimate(counts MultinomialCounts, backoff Multinomial) Multinomial {
+	pseudo := estimator.K * float64(backoff.support)
+	return discounted(counts, backoff, func(count float64) float64 { return count },
+		counts.Total() + pseudo, true)
+}
+
+// Interpolate with the backoff distribution using a fixed weight Lambda on
+// the relative frequencies.
+type LinearInterpolationEstimator struct {
+	Lambda float64
+}
+
+func (estimator LinearInterpolationEstimator) Estimate(counts MultinomialCounts, backoff Multinomial) Multinomial {
+	total := counts.Total()
+	if total == 0 {
+		return discounted(counts, backoff, nil, 0, true)
+	}
+	return discounted(counts, backoff, func(count float64) float64 { return estimator.Lambda * count },
+		total, true)
+}
+
+// Witten-Bell smoothing: the backoff weight is the fraction of events that
+// were the first occurrence of a new key.
+type WittenBellEstimator struct {}
+
+func (estimator WittenBellEstimator) Estimate(counts MultinomialCounts, backoff Multinomial) Multinomial {
+	return discounted(counts, backoff, func(count float64) float64 { return count },
+		counts.Total() + float64(counts.Types()), true)
+}
+
+// Interpolated absolute discounting: subtract Discount from every seen count
+// and give the freed mass to the backoff distribution.
+type AbsoluteDiscountingEstimator struct {
+	Discount float64
+}
+
+func (estimator AbsoluteDiscountingEstimator) Estimate(counts MultinomialCounts, backoff Multinomial) Multinomial {
+	return discounted(counts, backoff, func(count float64) float64 {
+		return math.Max(count - estimator.Discount, 0)
+	}, counts.Total(), true)
+}
+
+// Interpolated Kneser-Ney. Estimates like absolute discounting, but when
+// used for HMM transitions the lower-order backoff distributions are built
+// from continuation counts: the number of distinct longer histories a
+// transition was seen after.
+type KneserNeyEstimator struct {
+	Discount float64
+}
+
+func (estimator KneserNeyEstimator) Estimate(counts MultinomialCounts, backoff Multinomial) Multinomial {
+	return AbsoluteDiscountingEstimator{estimator.Discount}.Estimate(counts, backoff)
+}
+
+// Good-Turing with Katz backoff. Counts below MaxCount are replaced by the
+// raw Turing estimate r* = (r + 1) N(r + 1) / N(r), without smoothing the
+// counts of counts N(r); a count stays as it is when N(r + 1) is zero. The
+// mass of singletons, N(1) / N, is shared among unseen keys in proportion
+// to the backoff distribution. With no singletons, N(1) is taken as 1 so
+// unseen keys keep some mass, and the unseen mass is capped at one half so
+// that tiny samples are not mostly backoff. A MaxCount of zero uses 5.
+type GoodTuringEstimator struct {
+	MaxCount int
+}
+
+func (estimator GoodTuringEstimator) Estimate(counts MultinomialCounts, backoff Multinomial) Multinomial {
+	total := counts.Total()
+	if total == 0 {
+		return discounted(counts, backoff, nil, 0, true)
+	}
+	max_count := estimator.MaxCount
+	if max_count == 0 {
+		max_count = 5
+	}
+
+	// Counts of counts, rounding fractional counts.
+	count_counts := map[int]int{}
+	for _, count := range counts.counts {
+		if count > 0 {
+			count_counts[int(count + 0.5)]++
+		}
+	}
+	singletons := float64(count_counts[1])
+	if singletons == 0 {
+		singletons = 1
+	}
+	unseen_mass := math.Min(singletons / total, 0.5)
+
+	multinomial := Multinomial{
+		distribution: make(map[int]float64),
+		support: backoff.support,
+		backoff: backoffPointer(backoff),
+	}
+	seen_total := 0.0
+	for key, count := range counts.counts {
+		if count <= 0 { continue }
+		r := int(count + 0.5)
+		adjusted := count
+		if r < max_count && r > 0 && count_counts[r + 1] > 0 {
+			adjusted = float64(r + 1) * float64(count_counts[r + 1]) / float64(count_counts[r])
+		}
+		multinomial.distribution[key] = adjusted
+		seen_total += adjusted
+	}
+	seen_backoff := 0.0
+	for key, prob := range multinomial.distribution {
+		multinomial.distribution[key] = (1 - unseen_mass) * prob / seen_total
+		seen_backoff += multinomial.backoffProb(key)
+	}
+	// If the seen keys hold nearly all of the backoff mass, the Katz weight
+	// would blow up, so treat them as covering the support.
+	if seen_backoff < 1 - 1e-9 {
+		multinomial.backoff_weight = unseen_mass / (1 - seen_backoff)
+	} else {
+		// Every key was seen; keep the distribution normalized.
+		for key, prob := range multinomial.distribution {
+			multinomial.distribution[key] = prob / (1 - unseen_mass)
+		}
+	}
+	return multinomial
+}
+
+// Build an interpolated multinomial with discount(count) / denominator on
+// each seen key and the remaining mass on the backoff. With no counts the
+// result is the backoff itself.
+func discounted(counts MultinomialCounts, backoff Multinomial,
+	discount func(float64) float64, denominator float64, interpolated bool) Multinomial {
+	multinomial := Multinomial{
+		distribution: make(map[int]float64),
+		support: backoff.support,
+		backoff: backoffPointer(backoff),
+		interpolated: interpolated,
+	}
+	if denominator <= 0 {
+		multinomial.backoff_weight = 1
+		return multinomial
+	}
+	mass := 0.0
+	for key, count := range counts.counts {
+		if count <= 0 { continue }
+		prob := discount(count) / denominator
+		multinomial.distribution[key] = prob
+		mass += prob
+	}
+	multinomial.backoff_weight = math.Max(1 - mass, 0)
+	return multinomial
+}
+
+// The estimator used for each kind of distribution in an HMM. Nil entries
+// use maximum likelihood.
+type HMMEstimators struct {
+	Start      Estimator
+	Transition Estimator
+	Emission   Estimator
+}
+
+func orMaximumLikelihood(estimator Estimator) Estimator {
+	if estimator == nil {
+		return MaximumLikelihoodEstimator{}
+	}
+	return estimator
+}
+
+func isKneserNey(estimator Estimator) bool {
+	_, ok := estimator.(KneserNeyEstimator)
+	return ok
+}
+
+// Parse an estimator description: "ml", "laplace", "add-k:K",
+// "interpolate:LAMBDA", "witten-bell", "good-turing", "absolute:D" or
+// "kneser-ney:D". Parameters may be omitted to use a default.
+func ParseEstimator(spec string) (Estimator, error) {
+	parts := strings.SplitN(spec, ":", 2)
+	name := parts[0]
+	value := func(default_value float64) (float64, error) {
+		if len(parts) == 1 {
+			return default_value, nil
+		}
+		return strconv.ParseFloat(parts[1], 64)
+	}
+	var estimator Estimator
+	var err error
+	var x float64
+	switch name {
+	case "ml", "":
+		estimator = MaximumLikelihoodEstimator{}
+	case "laplace":
+		estimator = AddKEstimator{1}
+	case "add-k":
+		x, err = value(1)
+		estimator = AddKEstimator{x}
+	case "interpolate":
+		x, err = value(0.9)
+		estimator = LinearInterpolationEstimator{x}
+	case "witten-bell":
+		estimator = WittenBellEstimator{}
+	case "good-turing":
+		x, err = value(5)
+		estimator = GoodTuringEstimator{int(x)}
+	case "absolute":
+		x, err = value(0.75)
+		estimator = AbsoluteDiscountingEstimator{x}
+	case "kneser-ney":
+		x, err = value(0.75)
+		estimator = KneserNeyEstimator{x}
+	default:
+		return nil, ParseError{error: fmt.Sprintf("Unknown estimator %q.", spec)}
+	}
+	if err != nil {
+		return nil, ParseError{error: fmt.Sprintf("Estimator %q: %s", spec, err)}
+	}
+	return estimator, nil
+}
+
+// The ParseEstimator spec for one of the estimators in this package, or ""
+// for nil, which means maximum likelihood. Other estimators have no spec.
+func EstimatorSpec(estimator Estimator) (string, error) {
+	format := func(name string, x float64) string {
+		return name + ":" + strconv.FormatFloat(x, 'g', -1, 64)
+	}
+	switch estimator := estimator.(type) {
+	case nil:
+		return "", nil
+	case MaximumLikelihoodEstimator:
+		return "ml", nil
+	case AddKEstimator:
+		return format("add-k", estimator.K), nil
+	case LinearInterpolationEstimator:
+		return format("interpolate", estimator.Lambda), nil
+	case WittenBellEstimator:
+		return "witten-bell", nil
+	case GoodTuringEstimator:
+		return format("good-turing", float64(estimator.MaxCount)), nil
+	case AbsoluteDiscountingEstimator:
+		return format("absolute", estimator.Discount), nil
+	case KneserNeyEstimator:
+		return format("kneser-ney", estimator.Discount), nil
+	}
+	return "", ModelError{fmt.Sprintf("Estimator %T has no spec.", estimator)}
+}
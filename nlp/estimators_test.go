@@ -0,0 +1,101 @@
+package nlp
+
+import (
+	"math"
+	"os"
+	"testing"
+)
+
+func Test_EstimatorsNormalize(t *testing.T) {
+	counts := NewCounts()
+	for key, count := range []float64{5, 1, 1, 2, 0, 0, 3, 1} {
+		if count > 0 {
+			counts.Add(key, count)
+		}
+	}
+	support := 10
+	backoff := counts.MaximumLikelihood()
+	backoff.support = support
+	backoff.backoff_weight = 0.5
+	backoff.interpolated = true
+	for i := range backoff.distribution {
+		backoff.distribution[i] *= 0.5
+	}
+	estimators := []Estimator{
+		AddKEstimator{1},
+		LinearInterpolationEstimator{0.8},
+		WittenBellEstimator{},
+		AbsoluteDiscountingEstimator{0.75},
+		KneserNeyEstimator{0.75},
+		GoodTuringEstimator{},
+	}
+	for _, estimator := range estimators {
+		for _, base := range []Multinomial{Uniform(support), backoff} {
+			multinomial := estimator.Estimate(counts, base)
+			sum := 0.0
+			for key := 0; key < support; key++ {
+				sum += multinomial.Prob(key)
+			}
+			if math.Abs(sum - 1) > 1e-9 {
+				t.Errorf("%T sums to %f.", estimator, sum)
+			}
+			if p := multinomial.Prob(support - 1); p <= 0 {
+				t.Errorf("%T gives unseen key probability %f.", estimator, p)
+			}
+		}
+	}
+	ml := MaximumLikelihoodEstimator{}.Estimate(counts, Uniform(support))
+	if p := ml.Prob(support - 1); p != 0 {
+		t.Errorf("Maximum likelihood gives unseen key probability %f.", p)
+	}
+}
+
+// The first 200 sentences of the question treebank dev set, with the
+// training set.
+func readQuestionTreebank(t *testing.T) (train Corpus, dev Corpus) {
+	train_file, err := os.Open("../static/qtb-train.tag")
+	if err != nil {
+		t.Fatalf("Couldn't open: %s", err)
+	}
+	defer train_file.Close()
+	train, err = ReadCorpus(train_file, "qtb-train.tag")
+	if err != nil {
+		t.Fatalf("Couldn't parse: %s", err)
+	}
+	dev_file, err := os.Open("../static/qtb-dev.tag")
+	if err != nil {
+		t.Fatalf("Couldn't open: %s", err)
+	}
+	defer dev_file.Close()
+	dev, err = ReadCorpus(dev_file, "qtb-dev.tag")
+	if err != nil {
+		t.Fatalf("Couldn't parse: %s", err)
+	}
+	dev.sentences = dev.sentences[:200]
+	return
+}
+
+// Dev accuracy of a tagger trained with config.
+func devAccuracy(t *testing.T, train Corpus, dev Corpus, config HmmConfiguration) float64 {
+	tagger := EstimateFromCorpus(train, config)
+	tagged, err := tagger.TagCorpus(dev)
+	if err != nil {
+		t.Fatalf("Couldn't tag: %s", err)
+	}
+	return ScoreTagging(dev, tagged).TagsResult.Percent()
+}
+
+func Test_SmoothedTagger(t *testing.T) {
+	train, dev := readQuestionTreebank(t)
+	for order := 1; order <= 2; order++ {
+		config := DefaultHmmConfiguration()
+		config.order = order
+		config.estimators = HMMEstimators{
+			Transition: WittenBellEstimator{},
+			Emission: AddKEstimator{0.01},
+		}
+		if accuracy := devAccuracy(t, train, dev, config); accuracy < 0.8 {
+			t.Errorf("Order %d: dev accuracy %0.3f.", order, accuracy)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package nlp
+
+import (
+	"math"
+)
+
+type EMConfiguration struct {
+	// Stop after this many iterations.
+	MaxIterations int
+
+	// Stop once the log-likelihood improves by less than this amount.
+	Tolerance float64
+
+	// If set, called after each E-step with the iteration number, the
+	// log-likelihood of the corpus under the current model, and that model.
+	Callback func(iteration int, log_likelihood float64, hmm HMM)
+
+	// How to re-estimate the HMM from expected counts. The zero value is
+	// maximum likelihood.
+	Estimators HMMEstimators
+
+	// The weight of a uniform distribution mixed into emissions that give
+	// no probability to words new to a tagger in TrainEM. Zero means
+	// DefaultUnseenEmissionWeight.
+	UnseenEmissionWeight float64
+}
+
+const DefaultUnseenEmissionWeight = 1e-3
+
+func DefaultEMConfiguration() EMConfiguration {
+	return EMConfiguration{
+		MaxIterations: 20,
+		Tolerance: 1e-4,
+		UnseenEmissionWeight: DefaultUnseenEmissionWeight,
+	}
+}
+
+// Add the expected counts of transitions and emissions for outcomes under
+// the HMM to counts. Returns the log-likelihood of the outcomes. Outcomes
+// with zero probability contribute nothing.
+func (hmm HMM) AddExpectedCounts(outcomes []Outcome, counts *HMMCounts) float64 {
+	alpha := hmm.Forward(outcomes)
+	beta := hmm.Backward(outcomes)
+	log_likelihood := hmm.logLikelihood(outcomes, alpha)
+	if math.IsInf(log_likelihood, -1) || len(outcomes) == 0 {
+		return log_likelihood
+	}
+	start := hmm.StartHistory()
+	stop := hmm.Stop()
+	for position, outcome := range outcomes {
+		var history History
+		for history = 0; history < hmm.NumHistories(); history++ {
+			prev_score := 0.0
+			if position == 0 {
+				if history != start { continue }
+			} else {
+				prev_score = alpha[position - 1][history]
+			}
+			if math.IsInf(prev_score, -1) { continue }
+			var state State
+			for state = 0; state < stop; state++ {
+				score := prev_score + hmm.LogProbTransition(history, state) +
+					hmm.LogProbEmission(state, outcome) +
+					beta[position][hmm.Extend(history, state)] - log_likelihood
+				if math.IsInf(score, -1) { continue }
+				expected := math.Exp(score)
+				counts.AddTransition(history, state, expected)
+				counts.AddEmission(state, outcome, expected)
+			}
+		}
+	}
+	end := len(outcomes) - 1
+	var history History
+	for history = 0; history < hmm.NumHistories(); history++ {
+		score := alpha[end][history] + hmm.LogProbTransition(history, stop) - log_likelihood
+		if math.IsInf(score, -1) { continue }
+		counts.AddTransition(history, stop, math.Exp(score))
+	}
+	return log_likelihood
+}
+
+// Re-estimate an HMM from untagged outcome sequences with the Baum-Welch
+// algorithm, starting from hmm. Returns the final HMM, and for each
+// iteration the corpus log-likelihood before re-estimation and the number of
+// sequences skipped because they have zero probability under the current
+// model. A tag dictionary on hmm is kept on every re-estimated HMM.
+func BaumWelch(hmm HMM, sentences [][]Outcome, config EMConfiguration) (HMM, []float64, []int) {
+	var log_likelihoods []float64
+	var skipped []int
+	for iteration := 0; iteration < config.MaxIterations; iteration++ {
+		counts := NewHMMCounts(int(hmm.num_states), int(hmm.num_outcomes), hmm.order)
+		log_likelihood := 0.0
+		skipped_sentences := 0
+		for _, outcomes := range sentences {
+			if l := hmm.AddExpectedCounts(outcomes, &counts); !math.IsInf(l, -1) {
+				log_likelihood += l
+			} else {
+				skipped_sentences++
+			}
+		}
+		log_likelihoods = append(log_likelihoods, log_likelihood)
+		skipped = append(skipped, skipped_sentences)
+		if config.Callback != nil {
+			config.Callback(iteration, log_likelihood, hmm)
+		}
+		if iteration > 0 &&
+			log_likelihood - log_likelihoods[iteration - 1] < config.Tolerance {
+			break
+		}
+		dictionary := hmm.dictionary
+		hmm = EstimateHMM(counts, config.Estimators)
+		hmm.dictionary = dictionary
+	}
+	return hmm, log_likelihoods, skipped
+}
+
+// A copy of the HMM over num_outcomes outcomes, at least as many as it has.
+// Smoothed emissions spread their backoff mass over the larger support.
+// Every other emission distribution mixes in weight of a uniform
+// distribution over all outcomes, so that no outcome has zero probability.
+func (hmm HMM) withOutcomes(num_outcomes Outcome, weight float64) HMM {
+	old_support := float64(hmm.num_outcomes + 1)
+	support := float64(num_outcomes + 1)
+	hmm.num_outcomes = num_outcomes
+	emissions := make([]Multinomial, len(hmm.emissions))
+	for state, emission := range hmm.emissions {
+		emissions[state] = emission
+		switch {
+		case emission.backoff_weight > 0 && emission.backoff == nil:
+			emissions[state].support = int(support)
+			if !emission.interpolated {
+				// A Katz weight covers the unseen keys only, so keep
+				// their total mass as more keys become unseen.
+				seen := float64(len(emission.distribution))
+				emissions[state].backoff_weight *= (1 - seen / old_support) / (1 - seen / support)
+			}
+		case emission.backoff_weight > 0 || State(state) == hmm.Stop():
+		default:
+			floored := Multinomial{
+				distribution: make(map[int]float64),
+				support: int(support),
+				backoff_weight: weight,
+				interpolated: true,
+			}
+			for key, prob := range emission.distribution {
+				floored.distribution[key] = (1 - weight) * prob
+			}
+			emissions[state] = floored
+		}
+	}
+	hmm.emissions = emissions
+	return hmm
+}
+
+// Refine a tagger on an untagged corpus with Baum-Welch. Words that the
+// tagger has not seen are added to a copy of its lexicon first. Smoothed
+// emissions are extended over them and unsmoothed emissions get a uniform
+// floor, so that sentences containing them have nonzero probability. Returns the log-likelihoods and skipped
+// sentence counts of BaumWelch.
+func (tagger HMMTagger) TrainEM(corpus Corpus, config EMConfiguration) (HMMTagger, []float64, []int) {
+	lexicon := tagger.lexicon.Copy()
+	for _, sentence := range corpus.sentences {
+		for _, token := range sentence {
+			word := tagger.mapper.Map(token.word)
+			if _, ok := lexicon.LookupWordId(word); !ok {
+				lexicon.words.UpdateTypeMap(word)
+			}
+		}
+	}
+	if lexicon.WordCount() > tagger.lexicon.WordCount() {
+		weight := config.UnseenEmissionWeight
+		if weight == 0 {
+			weight = DefaultUnseenEmissionWeight
+		}
+		tagger.hmm = tagger.hmm.withOutcomes(Outcome(lexicon.WordCount()), weight)
+	}
+	tagger.lexicon = lexicon
+
+	sentences := make([][]Outcome, len(corpus.sentences))
+	for i, sentence := range corpus.sentences {
+		sentences[i] = tagger.Outcomes(sentence)
+	}
+	hmm, log_likelihoods, skipped := BaumWelch(tagger.hmm, sentences, config)
+	tagger.hmm = hmm
+	return tagger, log_likelihoods, skipped
+}
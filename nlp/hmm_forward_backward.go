@@ -0,0 +1,135 @@
+package nlp
+
+import (
+	"math"
+)
+
+// Add two log-probabilities without leaving log space.
+func logAdd(a float64, b float64) float64 {
+	if math.IsInf(a, -1) {
+		return b
+	}
+	if math.IsInf(b, -1) {
+		return a
+	}
+	if a < b {
+		a, b = b, a
+	}
+	return a + math.Log1p(math.Exp(b - a))
+}
+
+func newLogColumn(size History) []float64 {
+	column := make([]float64, size)
+	for i := range column {
+		column[i] = math.Inf(-1)
+	}
+	return column
+}
+
+// Compute forward log-probabilities. alpha[t][h] is the log-probability of
+// the outcomes up to and including position t with history h after t.
+func (hmm HMM) Forward(outcomes []Outcome) (alpha [][]float64) {
+	num_histories := hmm.NumHistories()
+	start := hmm.StartHistory()
+	stop := hmm.Stop()
+	alpha = make([][]float64, len(outcomes))
+	emissions := make([]float64, stop)
+	for position, outcome := range outcomes {
+		alpha[position] = newLogColumn(num_histories)
+		var state State
+		for state = 0; state < stop; state++ {
+			emissions[state] = hmm.LogProbEmission(state, outcome)
+		}
+		var history History
+		for history = 0; history < num_histories; history++ {
+			prev_score := 0.0
+			if position == 0 {
+				if history != start { continue }
+			} else {
+				prev_score = alpha[position - 1][history]
+			}
+			if math.IsInf(prev_score, -1) { continue }
+			for state = 0; state < stop; state++ {
+				if math.IsInf(emissions[state], -1) { continue }
+				next := hmm.Extend(history, state)
+				alpha[position][next] = logAdd(alpha[position][next],
+					prev_score + hmm.LogProbTransition(history, state) + emissions[state])
+			}
+		}
+	}
+	return
+}
+
+// Compute backward log-probabilities. beta[t][h] is the log-probability of
+// the outcomes after position t, and the final STOP, given history h after t.
+func (hmm HMM) Backward(outcomes []Outcome) (beta [][]float64) {
+	num_histories := hmm.NumHistories()
+	stop := hmm.Stop()
+	beta = make([][]float64, len(outcomes))
+	emissions := make([]float64, stop)
+	for position := len(outcomes) - 1; position >= 0; position-- {
+		beta[position] = newLogColumn(num_histories)
+		var history History
+		if position == len(outcomes) - 1 {
+			for history = 0; history < num_histories; history++ {
+				beta[position][history] = hmm.LogProbTransition(history, stop)
+			}
+			continue
+		}
+		var state State
+		for state = 0; state < stop; state++ {
+			emissions[state] = hmm.LogProbEmission(state, outcomes[position + 1])
+		}
+		for history = 0; history < num_histories; history++ {
+			for state = 0; state < stop; state++ {
+				next_score := beta[position + 1][hmm.Extend(history, state)]
+				if math.IsInf(emissions[state], -1) || math.IsInf(next_score, -1) { continue }
+				beta[position][history] = logAdd(beta[position][history],
+					hmm.LogProbTransition(history, state) + emissions[state] + next_score)
+			}
+		}
+	}
+	return
+}
+
+// The log-probability of outcomes summed over all state paths, given the
+// forward chart.
+func (hmm HMM) logLikelihood(outcomes []Outcome, alpha [][]float64) float64 {
+	if len(outcomes) == 0 {
+		return hmm.LogProbTransition(hmm.StartHistory(), hmm.Stop())
+	}
+	log_likelihood := math.Inf(-1)
+	end := len(outcomes) - 1
+	var history History
+	for history = 0; history < hmm.NumHistories(); history++ {
+		log_likelihood = logAdd(log_likelihood,
+			alpha[end][history] + hmm.LogProbTransition(history, hmm.Stop()))
+	}
+	return log_likelihood
+}
+
+func (hmm HMM) LogLikelihood(outcomes []Outcome) float64 {
+	return hmm.logLikelihood(outcomes, hmm.Forward(outcomes))
+}
+
+// Compute the posterior probability of each state at each position.
+// posteriors[t][s] is the probability that position t is in state s given
+// all of the outcomes; STOP is not included. Also returns the log-likelihood
+// of the outcomes, which is negative infinity when no path is possible.
+func (hmm HMM) Posteriors(outcomes []Outcome) (posteriors [][]float64, log_likelihood float64) {
+	alpha := hmm.Forward(outcomes)
+	beta := hmm.Backward(outcomes)
+	log_likelihood = hmm.logLikelihood(outcomes, alpha)
+	posteriors = make([][]float64, len(outcomes))
+	for position := range outcomes {
+		posteriors[position] = make([]float64, hmm.Stop())
+		if math.IsInf(log_likelihood, -1) { continue }
+		var history History
+		for history = 0; history < hmm.NumHistories(); history++ {
+			score := alpha[position][history] + beta[position][history]
+			if math.IsInf(score, -1) { continue }
+			posteriors[position][hmm.LastState(history)] += math.Exp(score - log_likelihood)
+		}
+	}
+	return
+}
@@ -1,148 +1,449 @@
 package nlp
 
+import (
+	"fmt"
+	"math"
+)
+
 type State int;
 type Outcome int;
 
+// The previous order states, packed base num_states with the most recent
+// state in the lowest digit. Positions before the start of the sentence are
+// filled with the STOP state.
+type History int;
+
 type HMM struct {
 	num_states State
 	num_outcomes Outcome
+	order int
 	transitions []Multinomial
+	// backoffs[k] holds the transition distributions for histories of the
+	// last k states, which the next longer histories back off to.
+	backoffs [][]Multinomial
 	emissions []Multinomial
-	start Multinomial
+	// Dense log transition probabilities, indexed by history * num_states +
+	// next state.
+	log_transitions []float64
+	// If set, prunes the states considered by Viterbi.
+	dictionary *TagDictionary
 }
 
 type HMMCounts struct {
 	num_states State
 	num_outcomes Outcome
-	transitions []MultinomialCounts
+	order int
+	transitions map[History]MultinomialCounts
 	emissions []MultinomialCounts
-	start MultinomialCounts
+}
+
+func numHistories(num_states State, order int) History {
+	histories := History(1)
+	for i := 0; i < order; i++ {
+		histories *= History(num_states)
+	}
+	return histories
+}
+
+// The most transition probabilities, num_states^(order + 1), that an HMM
+// may have. Transitions, the Viterbi chart and the forward-backward tables
+// are all dense over histories, so memory grows with this number: 45 tags
+// and order 3 give about 4.5 million, while order 4 gives over 200 million
+// and would need gigabytes.
+const MaxTransitions = 1 << 24
+
+// Returns a ModelError if an HMM with num_states states, including STOP,
+// and the given order would have more than MaxTransitions transitions.
+func CheckHMMSize(num_states State, order int) error {
+	size := int64(num_states)
+	for i := 0; i < order && size <= MaxTransitions; i++ {
+		size *= int64(num_states)
+	}
+	if size > MaxTransitions {
+		return ModelError{fmt.Sprintf(
+			"An HMM with %d states and order %d has more than %d transitions.",
+			num_states, order, MaxTransitions)}
+	}
+	return nil
+}
+
+func startHistory(num_states State, order int) History {
+	var history History
+	for i := 0; i < order; i++ {
+		history = history * History(num_states) + History(num_states - 1)
+	}
+	return history
 }
 
 func MaximumLikelihoodHMM(counts HMMCounts) HMM {
+	return EstimateHMM(counts, HMMEstimators{})
+}
+
+// Estimate an HMM from counts with a choice of estimator for each kind of
+// distribution. The counts' size is not checked against MaxTransitions. Transitions back off to successively shorter histories and
+// finally to a uniform distribution over states. Emissions back off to a
+// uniform distribution over the outcomes plus one unknown outcome,
+// num_outcomes.
+func EstimateHMM(counts HMMCounts, estimators HMMEstimators) HMM {
+	start_estimator := orMaximumLikelihood(estimators.Start)
+	transition_estimator := orMaximumLikelihood(estimators.Transition)
+	emission_estimator := orMaximumLikelihood(estimators.Emission)
 	hmm := HMM {
 		num_states : counts.num_states,
 		num_outcomes : counts.num_outcomes,
+		order : counts.order,
 		emissions: make([]Multinomial, counts.num_states),
-		transitions: make([]Multinomial, counts.num_states),
-		start : counts.start.MaximumLikelihood(),
+		transitions: make([]Multinomial, numHistories(counts.num_states, counts.order)),
+		backoffs: make([][]Multinomial, counts.order),
 	}
+	emission_backoff := Uniform(int(counts.num_outcomes) + 1)
 	var state State
 	for state = 0; state < hmm.num_states; state++  {
-		hmm.emissions[state] = counts.emissions[state].MaximumLikelihood()
-		hmm.transitions[state] = counts.transitions[state].MaximumLikelihood()
+		hmm.emissions[state] = emission_estimator.Estimate(counts.emissions[state], emission_backoff)
+	}
+
+	// Collect counts for shorter histories from the next longer ones.
+	level_counts := make([]map[History]MultinomialCounts, hmm.order + 1)
+	level_counts[hmm.order] = counts.transitions
+	for length := hmm.order - 1; length >= 0; length-- {
+		level := make(map[History]MultinomialCounts)
+		num_histories := numHistories(hmm.num_states, length)
+		for history, transition := range level_counts[length + 1] {
+			suffix := history % num_histories
+			if _, ok := level[suffix]; !ok {
+				level[suffix] = NewCounts()
+			}
+			lower := level[suffix]
+			for key, count := range transition.counts {
+				if count <= 0 { continue }
+				if isKneserNey(transition_estimator) {
+					lower.Inc(key)
+				} else {
+					lower.Add(key, count)
+				}
+			}
+		}
+		level_counts[length] = level
+	}
+
+	backoff := Uniform(int(hmm.num_states))
+	for length := 0; length < hmm.order; length++ {
+		hmm.backoffs[length] = make([]Multinomial, numHistories(hmm.num_states, length))
+		for history := range hmm.backoffs[length] {
+			if length > 0 {
+				backoff = hmm.backoffs[length - 1][History(history) % numHistories(hmm.num_states, length - 1)]
+			}
+			hmm.backoffs[length][history] =
+				transition_estimator.Estimate(level_counts[length][History(history)], backoff)
+		}
 	}
-	hmm.start = counts.start.MaximumLikelihood()
+	start := hmm.StartHistory()
+	lower := numHistories(hmm.num_states, hmm.order - 1)
+	for history := range hmm.transitions {
+		estimator := transition_estimator
+		if History(history) == start {
+			estimator = start_estimator
+		}
+		hmm.transitions[history] = estimator.Estimate(counts.transitions[History(history)],
+			hmm.backoffs[hmm.order - 1][History(history) % lower])
+	}
+	hmm.linkBackoffs()
+	hmm.cacheLogTransitions()
 	return hmm
 }
 
-func NewHMMCounts(num_states int, num_outcomes int) HMMCounts {
+func (hmm *HMM) cacheLogTransitions() {
+	hmm.log_transitions = make([]float64, len(hmm.transitions) * int(hmm.num_states))
+	for history := range hmm.transitions {
+		var state State
+		for state = 0; state < hmm.num_states; state++ {
+			hmm.log_transitions[history * int(hmm.num_states) + int(state)] =
+				math.Log(hmm.transitions[history].Prob(int(state)))
+		}
+	}
+}
+
+// Point each transition distribution at the shared distribution for its
+// history with the oldest state dropped.
+func (hmm *HMM) linkBackoffs() {
+	for length := 1; length < hmm.order; length++ {
+		lower := numHistories(hmm.num_states, length - 1)
+		for history := range hmm.backoffs[length] {
+			hmm.backoffs[length][history].backoff = &hmm.backoffs[length - 1][History(history) % lower]
+		}
+	}
+	lower := numHistories(hmm.num_states, hmm.order - 1)
+	for history := range hmm.transitions {
+		hmm.transitions[history].backoff = &hmm.backoffs[hmm.order - 1][History(history) % lower]
+	}
+}
+
+func NewHMMCounts(num_states int, num_outcomes int, order int) HMMCounts {
 	counts := HMMCounts {
 		num_states: State(num_states),
 		num_outcomes: Outcome(num_outcomes),
+		order: order,
 		emissions : make([]MultinomialCounts, num_states),
-		transitions : make([]MultinomialCounts, num_states),
-		start : NewCounts(),
+		transitions : make(map[History]MultinomialCounts),
 	}
 	var emission State
 	for emission = 0; emission < counts.num_states; emission++ {
 		counts.emissions[emission] = NewCounts()
 	}
-	var state State
-	for state = 0; state < counts.num_states; state++ {
-		counts.transitions[state] = NewCounts()
-	}
 	return counts
 }
 
+func (counts HMMCounts) StartHistory() History {
+	return startHistory(counts.num_states, counts.order)
+}
+
+func (counts HMMCounts) Extend(history History, state State) History {
+	return (history * History(counts.num_states) + History(state)) %
+		numHistories(counts.num_states, counts.order)
+}
+
 func (counts *HMMCounts) IncStart(state State) {
-	counts.start.Inc(int(state))
+	counts.IncTransition(counts.StartHistory(), state)
 }
 
-func (counts *HMMCounts) IncTransition(state State, next_state State) {
-	counts.transitions[state].Inc(int(next_state))
+func (counts *HMMCounts) IncTransition(history History, next_state State) {
+	counts.AddTransition(history, next_state, 1)
 }
 
 func (counts *HMMCounts) IncEmission(state State, outcome Outcome) {
-	counts.emissions[state].Inc(int(outcome))
+	counts.AddEmission(state, outcome, 1)
+}
+
+func (counts *HMMCounts) AddTransition(history History, next_state State, count float64) {
+	if _, ok := counts.transitions[history]; !ok {
+		counts.transitions[history] = NewCounts()
+	}
+	transition := counts.transitions[history]
+	transition.Add(int(next_state), count)
+}
+
+func (counts *HMMCounts) AddEmission(state State, outcome Outcome, count float64) {
+	counts.emissions[state].Add(int(outcome), count)
+}
+
+func (hmm HMM) NumStates() State {
+	return hmm.num_states
+}
+
+func (hmm HMM) NumOutcomes() Outcome {
+	return hmm.num_outcomes
+}
+
+func (hmm HMM) Order() int {
+	return hmm.order
+}
+
+// By convention the last state of an HMM is STOP, which emits nothing.
+func (hmm HMM) Stop() State {
+	return hmm.num_states - 1
+}
+
+func (hmm HMM) NumHistories() History {
+	return numHistories(hmm.num_states, hmm.order)
+}
+
+// The history before the first word, made up entirely of STOP states.
+func (hmm HMM) StartHistory() History {
+	return startHistory(hmm.num_states, hmm.order)
+}
+
+// Shift state onto history, dropping the oldest state.
+func (hmm HMM) Extend(history History, state State) History {
+	return (history * History(hmm.num_states) + History(state)) % hmm.NumHistories()
+}
+
+// The most recent state of history.
+func (hmm HMM) LastState(history History) State {
+	return State(history % History(hmm.num_states))
 }
 
 func (hmm HMM) ProbStart(state State) float64 {
-	return hmm.start.Prob(int(state))
+	return hmm.ProbTransition(hmm.StartHistory(), state)
 }
 
-func (hmm HMM) ProbTransition(state State, next_state State) float64 {
-	return hmm.transitions[state].Prob(int(next_state))
+func (hmm HMM) ProbTransition(history History, next_state State) float64 {
+	return hmm.transitions[history].Prob(int(next_state))
 }
 
 func (hmm HMM) ProbEmission(state State, outcome Outcome) float64 {
 	return hmm.emissions[state].Prob(int(outcome))
 }
 
-type loc struct {
-	position int
-	state State
+func (hmm HMM) LogProbTransition(history History, next_state State) float64 {
+	if hmm.log_transitions != nil {
+		return hmm.log_transitions[int(history) * int(hmm.num_states) + int(next_state)]
+	}
+	return math.Log(hmm.ProbTransition(history, next_state))
+}
+
+func (hmm HMM) LogProbEmission(state State, outcome Outcome) float64 {
+	return math.Log(hmm.ProbEmission(state, outcome))
+}
+
+// The joint log-probability of a state path and its outcomes, including the
+// final transition to STOP.
+func (hmm HMM) LogProbPath(outcomes []Outcome, states []State) float64 {
+	history := hmm.StartHistory()
+	score := 0.0
+	for position, state := range states {
+		score += hmm.LogProbTransition(history, state) +
+			hmm.LogProbEmission(state, outcomes[position])
+		history = hmm.Extend(history, state)
+	}
+	return score + hmm.LogProbTransition(history, hmm.Stop())
 }
 
+// A dense Viterbi chart with one column of histories per position. active
+// lists the reachable histories in each column.
 type chartType struct {
-	cells *map[loc]cell
+	num_histories History
+	scores []float64
+	backs []History
+	active [][]History
 }
 
-type cell struct {
-	score float64
-	best State
+func newChart(length int, num_histories History) chartType {
+	chart := chartType {
+		num_histories : num_histories,
+		scores : make([]float64, length * int(num_histories)),
+		backs : make([]History, length * int(num_histories)),
+		active : make([][]History, length),
+	}
+	for i := range chart.scores {
+		chart.scores[i] = math.Inf(-1)
+	}
+	return chart
 }
 
-func (chart *chartType) set_score(location loc, state State, score float64) {
-	if (score > (*chart.cells)[location].score) {
-		(*chart.cells)[location] = cell { score, state }
+func (chart chartType) index(position int, history History) int {
+	return position * int(chart.num_histories) + int(history)
+}
+
+func (chart chartType) score(position int, history History) float64 {
+	return chart.scores[chart.index(position, history)]
+}
+
+func (chart chartType) back(position int, history History) History {
+	return chart.backs[chart.index(position, history)]
+}
+
+func (chart chartType) set_score(position int, history History, back History, score float64) {
+	i := chart.index(position, history)
+	if math.IsInf(chart.scores[i], -1) && !math.IsInf(score, -1) {
+		chart.active[position] = append(chart.active[position], history)
+	}
+	if score > chart.scores[i] {
+		chart.scores[i] = score
+		chart.backs[i] = back
 	}
 }
 
-func (hmm HMM) RunViterbi(outcomes []Outcome) (float64, []State) {
-	chart := &chartType {
-		cells : &map[loc]cell {},
+// Fill one column of the Viterbi chart, trying candidates(history) after
+// each history in the previous column. Returns false if no cell could be
+// reached.
+func (hmm HMM) viterbiColumn(chart chartType, position int, emissions []float64,
+	candidates func(History) []State) bool {
+	filled := false
+	previous := []History{hmm.StartHistory()}
+	if position > 0 {
+		previous = chart.active[position - 1]
+	}
+	for _, history := range previous {
+		prev_score := 0.0
+		if position > 0 {
+			prev_score = chart.score(position - 1, history)
+		}
+		next := hmm.Extend(history, 0)
+		for _, state := range candidates(history) {
+			if math.IsInf(emissions[state], -1) { continue }
+			score := prev_score + hmm.LogProbTransition(history, state) + emissions[state]
+			if math.IsInf(score, -1) { continue }
+			chart.set_score(position, next + History(state), history, score)
+			filled = true
+		}
 	}
+	return filled
+}
 
-	// Initialize.
+// Find the most likely state path for outcomes. Returns the joint
+// log-probability of the path, including the transition to STOP, and the
+// path in sentence order. If every path has zero probability the score is
+// negative infinity and the path is nil.
+//
+// With a tag dictionary, each position only considers the states allowed
+// for its outcome and history. If that leaves no path through a position,
+// the position is retried without transition pruning, then with every
+// state.
+func (hmm HMM) RunViterbi(outcomes []Outcome) (float64, []State) {
+	start := hmm.StartHistory()
+	stop := hmm.Stop()
+	if len(outcomes) == 0 {
+		return hmm.LogProbTransition(start, stop), nil
+	}
+	num_histories := hmm.NumHistories()
+	chart := newChart(len(outcomes), num_histories)
+	emissions := make([]float64, stop)
+	all_states := make([]State, stop)
+	allowed := make([]bool, stop)
 	var state State
-	for state = 0; state < hmm.num_states; state++ {
-		chart.set_score(loc{0, state}, 0, hmm.ProbStart(state))
+	for state = 0; state < stop; state++ {
+		all_states[state] = state
 	}
+	every_state := func(History) []State { return all_states }
 
-	// Main loop.
 	for position, outcome := range outcomes {
-		if position == 0 { continue }
-		var state State
-		for state = 0; state < hmm.num_states; state++ {
-			var prev_state State
-			prob_emission := hmm.ProbEmission(state, outcome)
-			for prev_state = 0; prev_state < hmm.num_states; prev_state++ {
-				score := (*chart.cells)[loc{position - 1, prev_state}].score +
-					hmm.ProbTransition(prev_state, state) + prob_emission
-				chart.set_score(loc{position, state}, prev_state, score)
+		for state = 0; state < stop; state++ {
+			emissions[state] = hmm.LogProbEmission(state, outcome)
+		}
+		filled := false
+		if hmm.dictionary != nil {
+			outcome_states := hmm.dictionary.States(outcome)
+			for state = 0; state < stop; state++ {
+				allowed[state] = false
+			}
+			for _, state := range outcome_states {
+				allowed[state] = true
 			}
+			filled = hmm.viterbiColumn(chart, position, emissions, func(history History) []State {
+				return hmm.dictionary.candidates(history, outcome_states, allowed, true)
+			})
+			if !filled {
+				filled = hmm.viterbiColumn(chart, position, emissions, func(History) []State {
+					return outcome_states
+				})
+			}
+		}
+		if !filled {
+			hmm.viterbiColumn(chart, position, emissions, every_state)
 		}
 	}
 
-	end := len(outcomes)
-
-	// Find best state.
-	var best State
-	best_score := 0.0
-	var states []State
-	for state = 0; state < hmm.num_states; state++ {
-		if s:= (*chart.cells)[loc{end, state}].score; s > best_score {
+	// Find best history, including the transition to STOP.
+	end := len(outcomes) - 1
+	var best History
+	best_score := math.Inf(-1)
+	for _, history := range chart.active[end] {
+		prev_score := chart.score(end, history)
+		if s := prev_score + hmm.LogProbTransition(history, stop); s > best_score {
 			best_score = s
-			best = state
+			best = history
 		}
 	}
+	if math.IsInf(best_score, -1) {
+		return best_score, nil
+	}
 
 	// Follow back pointers to find the final path.
-	cur_state := best
-	for position := end; position >=0; position-- {
-		states = append(states, state)
-		cur_state = (*chart.cells)[loc{position, cur_state}].best
+	states := make([]State, len(outcomes))
+	cur_history := best
+	for position := end; position >= 0; position-- {
+		states[position] = hmm.LastState(cur_history)
+		cur_history = chart.back(position, cur_history)
 	}
 	return best_score, states
-}
\ No newline at end of file
+}
@@ -0,0 +1,286 @@
+package nlp
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	htemplate "html/template"
+	"io"
+	"strconv"
+	ttemplate "text/template"
+)
+
+type Results struct {
+	GoldName string         `json:"gold_name"`
+	TestName string         `json:"test_name"`
+	Results  TaggingResults `json:"results"`
+}
+
+// The MIME type of a report of the given type.
+func ResultsContentType(typ string) string {
+	switch typ {
+	case "json":
+		return "application/json; charset=utf-8"
+	case "html":
+		return "text/html; charset=utf-8"
+	case "csv":
+		return "text/csv; charset=utf-8"
+	}
+	return "text/plain; charset=utf-8"
+}
+
+// Write a scoring report as "json", "html", "csv", or, for any other type,
+// text.
+func WriteResults(writer io.Writer, results Results, typ string) error {
+	switch typ {
+	case "json":
+		b, err := json.Marshal(results)
+		if err != nil {
+			return err
+		}
+		_, err = writer.Write(b)
+		return err
+	case "html":
+		return tagResultTemplate.Execute(writer, results)
+	case "csv":
+		return writeResultsCSV(writer, results)
+	}
+	return tagResultTxtTemplate.Execute(writer, results)
+}
+
+const tagResultHtml = `
+<html>
+<title>
+</title>
+<body>
+Tag Results
+
+Gold File: {{.GoldName}}
+Test File: {{.TestName}}
+
+{{with .Results}} 
+{{with .TagsResult}}
+Correct: {{.Correct}}
+Total: {{.Total}}
+{{end}}
+{{with .Words}}
+Word Accuracy
+<table>
+<tr><th>Words</th><th>Correct</th><th>Total</th><th>Percent</th></tr>
+{{range .List}}
+<tr><td>{{.Name}}</td><td>{{.Correct}}</td><td>{{.Total}}</td><td>{{.Percent}}</td></tr>
+{{end}}
+</table>
+{{end}}
+<table>
+<tr><th>Name</th><th>Correct</th><th>Total</th><th>Percent</th></tr>
+{{range .TagResults}}
+<tr><td>{{.Name}}</td><td>{{.Correct}}</td><td>{{.Total}}</td><td>{{.Percent}}</td></tr>
+{{end}}
+</table>
+Precision, Recall and F1
+<table>
+<tr><th>Name</th><th>Gold</th><th>Predicted</th><th>Correct</th><th>Precision</th><th>Recall</th><th>F1</th></tr>
+{{range .TagPRF}}
+<tr><td>{{.Name}}</td><td>{{.Gold}}</td><td>{{.Predicted}}</td><td>{{.Correct}}</td><td>{{printf "%0.3f" .Precision}}</td><td>{{printf "%0.3f" .Recall}}</td><td>{{printf "%0.3f" .F1}}</td></tr>
+{{end}}
+{{with .MicroPRF}}
+<tr><th>{{.Name}}</th><td>{{.Gold}}</td><td>{{.Predicted}}</td><td>{{.Correct}}</td><td>{{printf "%0.3f" .Precision}}</td><td>{{printf "%0.3f" .Recall}}</td><td>{{printf "%0.3f" .F1}}</td></tr>
+{{end}}
+{{with .MacroPRF}}
+<tr><th>{{.Name}}</th><td></td><td></td><td></td><td>{{printf "%0.3f" .Precision}}</td><td>{{printf "%0.3f" .Recall}}</td><td>{{printf "%0.3f" .F1}}</td></tr>
+{{end}}
+</table>
+{{if .TestOnlyTags}}
+Tags only in the test file: {{range .TestOnlyTags}}{{.}} {{end}}
+{{end}}
+{{if .TopConfusions}}
+Most Frequent Confusions
+<table>
+<tr><th>Gold</th><th>Test</th><th>Count</th></tr>
+{{range .TopConfusions}}
+<tr><td>{{.Gold}}</td><td>{{.Test}}</td><td>{{.Count}}</td></tr>
+{{end}}
+</table>
+{{end}}
+{{with .Confusion}}
+Confusion Matrix (rows gold, columns test)
+<table>
+<tr><th></th>{{range .Tags}}<th>{{.}}</th>{{end}}</tr>
+{{range .Rows}}
+<tr><th>{{.Gold}}</th>{{range .Counts}}<td>{{if .}}{{.}}{{end}}</td>{{end}}</tr>
+{{end}}
+</table>
+{{end}}
+{{end}}
+</body>
+</html>
+`
+
+// One row per result: the overall tag and sentence accuracy, the word
+// classes if scored against training, then each tag.
+func writeResultsCSV(writer io.Writer, results Results) error {
+	csv_writer := csv.NewWriter(writer)
+	row := func(kind string, result HammingResult) []string {
+		return []string{
+			results.GoldName,
+			results.TestName,
+			kind,
+			result.Name,
+			strconv.Itoa(result.Correct),
+			strconv.Itoa(result.Total),
+			strconv.FormatFloat(result.Percent(), 'f', 4, 64),
+		}
+	}
+	csv_writer.Write([]string{"gold_name", "test_name", "kind", "name", "correct", "total", "percent"})
+	csv_writer.Write(row("tags", results.Results.TagsResult))
+	csv_writer.Write(row("sentences", results.Results.SentencesResult))
+	if words := results.Results.Words; words != nil {
+		for _, result := range words.List() {
+			csv_writer.Write(row("words", result))
+		}
+	}
+	for _, result := range results.Results.TagResults {
+		csv_writer.Write(row("tag", result))
+	}
+	csv_writer.Flush()
+	return csv_writer.Error()
+}
+
+var tagResultTemplate = htemplate.Must(htemplate.New("tag_result").Parse(tagResultHtml))
+
+const tagResultTxt = `
+Tag Results
+
+Test file: {{.TestName}}
+Gold file: {{.GoldName}}
+
+{{with .Results}} 
+Tags
+----
+{{with .TagsResult }} 
+Correct:  {{printf "%5d" .Correct}}
+Total:    {{printf "%5d" .Total}}
+Accuracy: {{printf "%0.3f" .Percent}}
+{{end}}
+
+Sentences
+---------
+{{with .SentencesResult }} 
+Correct:  {{printf "%5d" .Correct}}
+Total:    {{printf "%5d" .Total}}
+Accuracy: {{printf "%0.3f" .Percent}}
+{{end}}
+
+{{with .Words}}
+Word Accuracy
+Words       | Correct | Total | Percent
+---------------------------------------
+{{range .List}}
+{{printf "%11s" .Name}} | {{printf "%6d" .Correct}} | {{printf "%6d" .Total}} | {{printf "%0.3f" .Percent}}
+{{end}}
+{{end}}
+
+Tag Accuracy
+Name   | Correct | Total | Percent
+----------------------------------
+{{range .TagResults}}
+{{printf "%6s" .Name}} | {{printf "%6d" .Correct}} | {{printf "%6d" .Total}} | {{printf "%0.3f" .Percent}}
+{{end}}
+
+Precision, Recall and F1
+Name   |   Gold | Predicted | Correct | Precision | Recall | F1
+----------------------------------------------------------------
+{{range .TagPRF}}
+{{printf "%6s" .Name}} | {{printf "%6d" .Gold}} | {{printf "%9d" .Predicted}} | {{printf "%7d" .Correct}} | {{printf "%9.3f" .Precision}} | {{printf "%6.3f" .Recall}} | {{printf "%0.3f" .F1}}
+{{end}}
+{{with .MicroPRF}}{{printf "%6s" .Name}} | {{printf "%6d" .Gold}} | {{printf "%9d" .Predicted}} | {{printf "%7d" .Correct}} | {{printf "%9.3f" .Precision}} | {{printf "%6.3f" .Recall}} | {{printf "%0.3f" .F1}}{{end}}
+{{with .MacroPRF}}{{printf "%6s" .Name}} | {{printf "%6s" ""}} | {{printf "%9s" ""}} | {{printf "%7s" ""}} | {{printf "%9.3f" .Precision}} | {{printf "%6.3f" .Recall}} | {{printf "%0.3f" .F1}}{{end}}
+{{if .TestOnlyTags}}
+Tags only in the test file: {{range .TestOnlyTags}}{{.}} {{end}}
+{{end}}
+{{if .TopConfusions}}
+Most Frequent Confusions
+Gold   | Test   | Count
+-----------------------
+{{range .TopConfusions}}
+{{printf "%6s" .Gold}} | {{printf "%6s" .Test}} | {{printf "%5d" .Count}}
+{{end}}
+{{end}}
+{{with .Confusion}}
+Confusion Matrix (rows gold, columns test)
+{{printf "%6s" ""}}{{range .Tags}} {{printf "%6s" .}}{{end}}
+{{range .Rows}}{{printf "%6s" .Gold}}{{range .Counts}} {{printf "%6d" .}}{{end}}
+{{end}}{{end}}
+{{end}}
+`
+
+var tagResultTxtTemplate = ttemplate.Must(ttemplate.New("tag_result").Parse(tagResultTxt))
+
+// Write a significance report as "json", "html" or, for any other type,
+// text.
+func WriteSignificance(writer io.Writer, significance Significance, typ string) error {
+	switch typ {
+	case "json":
+		b, err := json.Marshal(significance)
+		if err != nil {
+			return err
+		}
+		_, err = writer.Write(b)
+		return err
+	case "html":
+		return significanceTemplate.Execute(writer, significance)
+	}
+	return significanceTxtTemplate.Execute(writer, significance)
+}
+
+const significanceHtml = `
+<html>
+<title>
+</title>
+<body>
+Significance
+
+Gold File: {{.GoldName}}
+A: {{.AName}}
+B: {{.BName}}
+
+{{.Samples}} samples, {{printf "%0.0f" (percent .Confidence)}}% intervals
+<table>
+<tr><th>Measure</th><th>A</th><th>B</th><th>B - A</th><th>Bootstrap p</th><th>Randomization p</th></tr>
+{{range .Measures}}
+<tr><td>{{.Name}}</td>
+<td>{{printf "%0.4f" .A}} [{{printf "%0.4f" .AInterval.Low}}, {{printf "%0.4f" .AInterval.High}}]</td>
+<td>{{printf "%0.4f" .B}} [{{printf "%0.4f" .BInterval.Low}}, {{printf "%0.4f" .BInterval.High}}]</td>
+<td>{{printf "%+0.4f" .Difference}} [{{printf "%+0.4f" .DifferenceInterval.Low}}, {{printf "%+0.4f" .DifferenceInterval.High}}]</td>
+<td>{{printf "%0.4f" .BootstrapP}}</td><td>{{printf "%0.4f" .RandomizationP}}</td></tr>
+{{end}}
+</table>
+</body>
+</html>
+`
+
+const significanceTxt = `
+Significance
+
+Gold file: {{.GoldName}}
+A:         {{.AName}}
+B:         {{.BName}}
+
+{{.Samples}} samples, {{printf "%0.0f" (percent .Confidence)}}% intervals
+{{range .Measures}}
+{{.Name}}
+A:               {{printf "%0.4f" .A}} [{{printf "%0.4f" .AInterval.Low}}, {{printf "%0.4f" .AInterval.High}}]
+B:               {{printf "%0.4f" .B}} [{{printf "%0.4f" .BInterval.Low}}, {{printf "%0.4f" .BInterval.High}}]
+B - A:           {{printf "%+0.4f" .Difference}} [{{printf "%+0.4f" .DifferenceInterval.Low}}, {{printf "%+0.4f" .DifferenceInterval.High}}]
+Bootstrap p:     {{printf "%0.4f" .BootstrapP}}
+Randomization p: {{printf "%0.4f" .RandomizationP}}
+{{end}}
+`
+
+var significanceFuncs = map[string]interface{}{
+	"percent": func(x float64) float64 { return 100 * x },
+}
+
+var significanceTemplate = htemplate.Must(htemplate.New("significance").Funcs(significanceFuncs).Parse(significanceHtml))
+
+var significanceTxtTemplate = ttemplate.Must(ttemplate.New("significance").Funcs(significanceFuncs).Parse(significanceTxt))
@@ -0,0 +1,31 @@
+package nlp
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func Test_WriteResults(t *testing.T) {
+	corpus, err := TagFormat{}.ReadCorpus(strings.NewReader(tagging_data))
+	if err != nil {
+		t.Fatalf("Couldn't parse: %s", err)
+	}
+	results := Results{GoldName: "gold.tag", TestName: "test.tag", Results: ScoreTagging(corpus, corpus)}
+	for _, typ := range []string{"text", "json", "html", "csv"} {
+		var out bytes.Buffer
+		if err := WriteResults(&out, results, typ); err != nil {
+			t.Errorf("Couldn't write %s report: %s", typ, err)
+		}
+		if !strings.Contains(out.String(), "test.tag") {
+			t.Errorf("%s report missing test name.", typ)
+		}
+		if typ == "json" {
+			var decoded Results
+			if err := json.Unmarshal(out.Bytes(), &decoded); err != nil {
+				t.Errorf("Couldn't decode json report: %s", err)
+			}
+		}
+	}
+}
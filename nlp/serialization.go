@@ -0,0 +1,629 @@
+package nlp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+)
+
+// Models are written either as JSON, for inspection, or as a compact gob
+// encoding prefixed with binaryModelMagic. Both carry ModelVersion, and
+// reading a model with a different version fails.
+const ModelVersion = 1
+
+var binaryModelMagic = []byte("NLPHMM\n")
+
+// Serialized forms of each type. They hold the same information as the
+// types themselves with exported fields, so both encoding/json and
+// encoding/gob can handle them.
+
+type stringMapData struct {
+	Types  []string `json:"types"`
+	Counts []int    `json:"counts"`
+}
+
+type lexiconData struct {
+	Tags   stringMapData `json:"tags"`
+	Words  stringMapData `json:"words"`
+	Labels stringMapData `json:"labels"`
+}
+
+type multinomialData struct {
+	Distribution  map[int]float64  `json:"distribution"`
+	Support       int              `json:"support"`
+	BackoffWeight float64          `json:"backoff_weight,omitempty"`
+	Interpolated  bool             `json:"interpolated,omitempty"`
+	Backoff       *multinomialData `json:"backoff,omitempty"`
+}
+
+type tagDictionaryData struct {
+	All        []State             `json:"all"`
+	ByOutcome  map[Outcome][]State `json:"by_outcome"`
+	Successors map[History][]State `json:"successors"`
+}
+
+type hmmData struct {
+	NumStates   State               `json:"num_states"`
+	NumOutcomes Outcome             `json:"num_outcomes"`
+	Order       int                 `json:"order"`
+	Transitions []multinomialData   `json:"transitions"`
+	Backoffs    [][]multinomialData `json:"backoffs"`
+	Emissions   []multinomialData   `json:"emissions"`
+	Dictionary  *tagDictionaryData  `json:"dictionary,omitempty"`
+}
+
+type hmmCountsData struct {
+	NumStates   State                       `json:"num_states"`
+	NumOutcomes Outcome                     `json:"num_outcomes"`
+	Order       int                         `json:"order"`
+	Transitions map[History]map[int]float64 `json:"transitions"`
+	Emissions   []map[int]float64           `json:"emissions"`
+}
+
+type wordMapperData struct {
+	Threshold  int      `json:"threshold"`
+	Signatures bool     `json:"signatures"`
+	Known      []string `json:"known"`
+}
+
+type hmmConfigurationData struct {
+	UnknownThreshold int  `json:"unknown_threshold"`
+	Signatures       bool `json:"signatures"`
+	Order            int  `json:"order"`
+	TagDictionary    bool `json:"tag_dictionary"`
+	DictionaryCutoff int  `json:"dictionary_cutoff"`
+	// Estimators are stored as ParseEstimator specs; empty means maximum
+	// likelihood.
+	Start      string `json:"start,omitempty"`
+	Transition string `json:"transition,omitempty"`
+	Emission   string `json:"emission,omitempty"`
+}
+
+type hmmTaggerData struct {
+	HMM     hmmData              `json:"hmm"`
+	Lexicon lexiconData          `json:"lexicon"`
+	Mapper  wordMapperData       `json:"mapper"`
+	Config  hmmConfigurationData `json:"config"`
+}
+
+// Errors writing a model, such as an estimator that cannot be stored.
+type ModelError struct {
+	error string
+}
+
+func (err ModelError) Error() string {
+	return err.error
+}
+
+type modelData struct {
+	Version int           `json:"version"`
+	Tagger  hmmTaggerData `json:"tagger"`
+}
+
+func (dsm dynamicStringMap) data() stringMapData {
+	return stringMapData{Types: dsm.forward_map, Counts: dsm.counts}
+}
+
+func stringMapFromData(data stringMapData) (dsm dynamicStringMap, err error) {
+	if len(data.Types) != len(data.Counts) {
+		return dsm, ParseError{error: "Lexicon types and counts differ in length."}
+	}
+	dsm = newDynamicStringMap()
+	for id, typ := range data.Types {
+		if _, ok := dsm.reverse_map[typ]; ok {
+			return dsm, ParseError{error: fmt.Sprintf("Lexicon type %q repeated.", typ)}
+		}
+		dsm.reverse_map[typ] = id
+		dsm.forward_map = append(dsm.forward_map, typ)
+		dsm.counts = append(dsm.counts, data.Counts[id])
+		dsm.counter++
+	}
+	return
+}
+
+func (lexicon Lexicon) data() lexiconData {
+	return lexiconData{
+		Tags:   lexicon.tags.data(),
+		Words:  lexicon.words.data(),
+		Labels: lexicon.labels.data(),
+	}
+}
+
+func lexiconFromData(data lexiconData) (lexicon *Lexicon, err error) {
+	lexicon = NewLexicon()
+	if lexicon.tags, err = stringMapFromData(data.Tags); err != nil {
+		return
+	}
+	if lexicon.words, err = stringMapFromData(data.Words); err != nil {
+		return
+	}
+	lexicon.labels, err = stringMapFromData(data.Labels)
+	return
+}
+
+// Serialize a multinomial, including its chain of backoff distributions if
+// with_backoff is set.
+func (multi Multinomial) data(with_backoff bool) multinomialData {
+	data := multinomialData{
+		Distribution:  multi.distribution,
+		Support:       multi.support,
+		BackoffWeight: multi.backoff_weight,
+		Interpolated:  multi.interpolated,
+	}
+	if with_backoff && multi.backoff != nil {
+		backoff := multi.backoff.data(true)
+		data.Backoff = &backoff
+	}
+	return data
+}
+
+func multinomialFromData(data multinomialData) Multinomial {
+	multi := Multinomial{
+		distribution:   data.Distribution,
+		support:        data.Support,
+		backoff_weight: data.BackoffWeight,
+		interpolated:   data.Interpolated,
+	}
+	if data.Backoff != nil {
+		backoff := multinomialFromData(*data.Backoff)
+		multi.backoff = &backoff
+	}
+	return multi
+}
+
+// Serialize a list of multinomials. Transition backoffs are shared and are
+// relinked on reading, so they are not written.
+func multinomialsData(multis []Multinomial) []multinomialData {
+	data := make([]multinomialData, len(multis))
+	for i, multi := range multis {
+		data[i] = multi.data(false)
+	}
+	return data
+}
+
+func multinomialsFromData(data []multinomialData) []Multinomial {
+	multis := make([]Multinomial, len(data))
+	for i, multi := range data {
+		multis[i] = multinomialFromData(multi)
+	}
+	return multis
+}
+
+func (hmm HMM) data() hmmData {
+	data := hmmData{
+		NumStates:   hmm.num_states,
+		NumOutcomes: hmm.num_outcomes,
+		Order:       hmm.order,
+		Transitions: multinomialsData(hmm.transitions),
+		Emissions:   multinomialsData(hmm.emissions),
+	}
+	for _, level := range hmm.backoffs {
+		data.Backoffs = append(data.Backoffs, multinomialsData(level))
+	}
+	if hmm.dictionary != nil {
+		data.Dictionary = &tagDictionaryData{
+			All:        hmm.dictionary.all,
+			ByOutcome:  hmm.dictionary.by_outcome,
+			Successors: hmm.dictionary.successors,
+		}
+	}
+	return data
+}
+
+// Check that a loaded multinomial and its backoffs are distributions over
+// keys below support. Estimated distributions may leave the support unset.
+func checkMultinomial(data multinomialData, support int) error {
+	if data.Support != 0 && data.Support != support {
+		return ParseError{error: fmt.Sprintf("HMM distribution has support %d, expected %d.",
+			data.Support, support)}
+	}
+	// Interpolated weights are a share of the probability mass. Katz weights
+	// rescale the backoff over the unseen keys only, and may exceed one.
+	if data.BackoffWeight < 0 || math.IsNaN(data.BackoffWeight) || math.IsInf(data.BackoffWeight, 0) ||
+		(data.Interpolated && data.BackoffWeight > 1) {
+		return ParseError{error: fmt.Sprintf("HMM backoff weight %f is out of range.",
+			data.BackoffWeight)}
+	}
+	for key, prob := range data.Distribution {
+		if key < 0 || key >= support {
+			return ParseError{error: fmt.Sprintf("HMM distribution has key %d, expected below %d.",
+				key, support)}
+		}
+		if prob < 0 || prob > 1 || math.IsNaN(prob) {
+			return ParseError{error: fmt.Sprintf("HMM probability %f for key %d.", prob, key)}
+		}
+	}
+	if data.Backoff != nil {
+		return checkMultinomial(*data.Backoff, support)
+	}
+	return nil
+}
+
+func checkMultinomials(data []multinomialData, support int) error {
+	for _, multi := range data {
+		if err := checkMultinomial(multi, support); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkStates(states []State, num_states State) error {
+	for _, state := range states {
+		if state < 0 || state >= num_states {
+			return ParseError{error: fmt.Sprintf("Tag dictionary state %d, expected below %d.",
+				state, num_states)}
+		}
+	}
+	return nil
+}
+
+func (data tagDictionaryData) check(hmm HMM) error {
+	if err := checkStates(data.All, hmm.num_states); err != nil {
+		return err
+	}
+	for outcome, states := range data.ByOutcome {
+		if outcome < 0 || outcome > hmm.num_outcomes {
+			return ParseError{error: fmt.Sprintf("Tag dictionary outcome %d, expected at most %d.",
+				outcome, hmm.num_outcomes)}
+		}
+		if err := checkStates(states, hmm.num_states); err != nil {
+			return err
+		}
+	}
+	for history, states := range data.Successors {
+		if history < 0 || history >= hmm.NumHistories() {
+			return ParseError{error: fmt.Sprintf("Tag dictionary history %d, expected below %d.",
+				history, hmm.NumHistories())}
+		}
+		if err := checkStates(states, hmm.num_states); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func hmmFromData(data hmmData) (hmm HMM, err error) {
+	if data.Order < 1 || data.NumStates < 1 || data.NumOutcomes < 0 {
+		return hmm, ParseError{error: "HMM needs at least one state and order one."}
+	}
+	if err = CheckHMMSize(data.NumStates, data.Order); err != nil {
+		return hmm, ParseError{error: err.Error()}
+	}
+	hmm = HMM{
+		num_states:   data.NumStates,
+		num_outcomes: data.NumOutcomes,
+		order:        data.Order,
+	}
+	if History(len(data.Transitions)) != hmm.NumHistories() ||
+		State(len(data.Emissions)) != hmm.num_states ||
+		len(data.Backoffs) != hmm.order {
+		return hmm, ParseError{error: "HMM distributions do not match its size."}
+	}
+	if err = checkMultinomials(data.Transitions, int(hmm.num_states)); err != nil {
+		return
+	}
+	if err = checkMultinomials(data.Emissions, int(hmm.num_outcomes) + 1); err != nil {
+		return
+	}
+	hmm.transitions = multinomialsFromData(data.Transitions)
+	hmm.emissions = multinomialsFromData(data.Emissions)
+	for length, level := range data.Backoffs {
+		if History(len(level)) != numHistories(hmm.num_states, length) {
+			return hmm, ParseError{error: "HMM backoff distributions do not match its size."}
+		}
+		if err = checkMultinomials(level, int(hmm.num_states)); err != nil {
+			return
+		}
+		hmm.backoffs = append(hmm.backoffs, multinomialsFromData(level))
+	}
+	if data.Dictionary != nil {
+		if err = data.Dictionary.check(hmm); err != nil {
+			return
+		}
+		hmm.dictionary = &TagDictionary{
+			all:        data.Dictionary.All,
+			by_outcome: data.Dictionary.ByOutcome,
+			successors: data.Dictionary.Successors,
+		}
+	}
+	hmm.linkBackoffs()
+	hmm.cacheLogTransitions()
+	return
+}
+
+func (counts HMMCounts) data() hmmCountsData {
+	data := hmmCountsData{
+		NumStates:   counts.num_states,
+		NumOutcomes: counts.num_outcomes,
+		Order:       counts.order,
+		Transitions: make(map[History]map[int]float64),
+	}
+	for history, transition := range counts.transitions {
+		data.Transitions[history] = transition.counts
+	}
+	for _, emission := range counts.emissions {
+		data.Emissions = append(data.Emissions, emission.counts)
+	}
+	return data
+}
+
+func hmmCountsFromData(data hmmCountsData) (counts HMMCounts, err error) {
+	if State(len(data.Emissions)) != data.NumStates {
+		return counts, ParseError{error: "HMM counts do not match their size."}
+	}
+	if err = CheckHMMSize(data.NumStates, data.Order); err != nil {
+		return counts, ParseError{error: err.Error()}
+	}
+	counts = NewHMMCounts(int(data.NumStates), int(data.NumOutcomes), data.Order)
+	for history, transition := range data.Transitions {
+		for key, count := range transition {
+			counts.AddTransition(history, State(key), count)
+		}
+	}
+	for state, emission := range data.Emissions {
+		for key, count := range emission {
+			counts.AddEmission(State(state), Outcome(key), count)
+		}
+	}
+	return
+}
+
+func (mapper WordMapper) data() wordMapperData {
+	data := wordMapperData{Threshold: mapper.threshold, Signatures: mapper.signatures}
+	for word := range mapper.known {
+		data.Known = append(data.Known, word)
+	}
+	sort.Strings(data.Known)
+	return data
+}
+
+func wordMapperFromData(data wordMapperData) WordMapper {
+	mapper := WordMapper{
+		threshold:  data.Threshold,
+		signatures: data.Signatures,
+		known:      make(map[string]bool),
+	}
+	for _, word := range data.Known {
+		mapper.known[word] = true
+	}
+	return mapper
+}
+
+func (tagger HMMTagger) data() (data hmmTaggerData, err error) {
+	data = hmmTaggerData{
+		HMM:     tagger.hmm.data(),
+		Lexicon: tagger.lexicon.data(),
+		Mapper:  tagger.mapper.data(),
+		Config: hmmConfigurationData{
+			UnknownThreshold: tagger.config.unknown_threshold,
+			Signatures:       tagger.config.signatures,
+			Order:            tagger.config.order,
+			TagDictionary:    tagger.config.tag_dictionary,
+			DictionaryCutoff: tagger.config.dictionary_cutoff,
+		},
+	}
+	estimators := tagger.config.estimators
+	if data.Config.Start, err = EstimatorSpec(estimators.Start); err != nil {
+		return
+	}
+	if data.Config.Transition, err = EstimatorSpec(estimators.Transition); err != nil {
+		return
+	}
+	data.Config.Emission, err = EstimatorSpec(estimators.Emission)
+	return
+}
+
+func estimatorFromSpec(spec string) (Estimator, error) {
+	if spec == "" {
+		return nil, nil
+	}
+	return ParseEstimator(spec)
+}
+
+func taggerFromData(data hmmTaggerData) (tagger HMMTagger, err error) {
+	if tagger.hmm, err = hmmFromData(data.HMM); err != nil {
+		return
+	}
+	if tagger.lexicon, err = lexiconFromData(data.Lexicon); err != nil {
+		return
+	}
+	if int(tagger.hmm.num_states) != tagger.lexicon.TagCount() + 1 {
+		return tagger, ParseError{error: "Tagger HMM and lexicon disagree on the number of tags."}
+	}
+	tagger.mapper = wordMapperFromData(data.Mapper)
+	tagger.config = HmmConfiguration{
+		unknown_threshold: data.Config.UnknownThreshold,
+		signatures:        data.Config.Signatures,
+		order:             data.Config.Order,
+		tag_dictionary:    data.Config.TagDictionary,
+		dictionary_cutoff: data.Config.DictionaryCutoff,
+	}
+	estimators := &tagger.config.estimators
+	if estimators.Start, err = estimatorFromSpec(data.Config.Start); err != nil {
+		return
+	}
+	if estimators.Transition, err = estimatorFromSpec(data.Config.Transition); err != nil {
+		return
+	}
+	estimators.Emission, err = estimatorFromSpec(data.Config.Emission)
+	return
+}
+
+// JSON and gob encodings for each serializable type.
+
+func gobEncode(data interface{}) ([]byte, error) {
+	var buffer bytes.Buffer
+	err := gob.NewEncoder(&buffer).Encode(data)
+	return buffer.Bytes(), err
+}
+
+func gobDecode(encoded []byte, data interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(encoded)).Decode(data)
+}
+
+func (lexicon Lexicon) MarshalJSON() ([]byte, error) {
+	return json.Marshal(lexicon.data())
+}
+
+func (lexicon *Lexicon) UnmarshalJSON(encoded []byte) error {
+	var data lexiconData
+	if err := json.Unmarshal(encoded, &data); err != nil {
+		return err
+	}
+	decoded, err := lexiconFromData(data)
+	if err == nil {
+		*lexicon = *decoded
+	}
+	return err
+}
+
+func (lexicon Lexicon) GobEncode() ([]byte, error) {
+	return gobEncode(lexicon.data())
+}
+
+func (lexicon *Lexicon) GobDecode(encoded []byte) error {
+	var data lexiconData
+	if err := gobDecode(encoded, &data); err != nil {
+		return err
+	}
+	decoded, err := lexiconFromData(data)
+	if err == nil {
+		*lexicon = *decoded
+	}
+	return err
+}
+
+func (multi Multinomial) MarshalJSON() ([]byte, error) {
+	return json.Marshal(multi.data(true))
+}
+
+func (multi *Multinomial) UnmarshalJSON(encoded []byte) error {
+	var data multinomialData
+	if err := json.Unmarshal(encoded, &data); err != nil {
+		return err
+	}
+	*multi = multinomialFromData(data)
+	return nil
+}
+
+func (multi Multinomial) GobEncode() ([]byte, error) {
+	return gobEncode(multi.data(true))
+}
+
+func (multi *Multinomial) GobDecode(encoded []byte) error {
+	var data multinomialData
+	if err := gobDecode(encoded, &data); err != nil {
+		return err
+	}
+	*multi = multinomialFromData(data)
+	return nil
+}
+
+func (hmm HMM) MarshalJSON() ([]byte, error) {
+	return json.Marshal(hmm.data())
+}
+
+func (hmm *HMM) UnmarshalJSON(encoded []byte) error {
+	var data hmmData
+	if err := json.Unmarshal(encoded, &data); err != nil {
+		return err
+	}
+	decoded, err := hmmFromData(data)
+	if err == nil {
+		*hmm = decoded
+	}
+	return err
+}
+
+func (hmm HMM) GobEncode() ([]byte, error) {
+	return gobEncode(hmm.data())
+}
+
+func (hmm *HMM) GobDecode(encoded []byte) error {
+	var data hmmData
+	if err := gobDecode(encoded, &data); err != nil {
+		return err
+	}
+	decoded, err := hmmFromData(data)
+	if err == nil {
+		*hmm = decoded
+	}
+	return err
+}
+
+func (counts HMMCounts) MarshalJSON() ([]byte, error) {
+	return json.Marshal(counts.data())
+}
+
+func (counts *HMMCounts) UnmarshalJSON(encoded []byte) error {
+	var data hmmCountsData
+	if err := json.Unmarshal(encoded, &data); err != nil {
+		return err
+	}
+	decoded, err := hmmCountsFromData(data)
+	if err == nil {
+		*counts = decoded
+	}
+	return err
+}
+
+func (counts HMMCounts) GobEncode() ([]byte, error) {
+	return gobEncode(counts.data())
+}
+
+func (counts *HMMCounts) GobDecode(encoded []byte) error {
+	var data hmmCountsData
+	if err := gobDecode(encoded, &data); err != nil {
+		return err
+	}
+	decoded, err := hmmCountsFromData(data)
+	if err == nil {
+		*counts = decoded
+	}
+	return err
+}
+
+// Write a trained tagger as a versioned model file, either as indented JSON
+// or in the binary encoding.
+func WriteModel(writer io.Writer, tagger HMMTagger, binary bool) error {
+	data, err := tagger.data()
+	if err != nil {
+		return err
+	}
+	model := modelData{Version: ModelVersion, Tagger: data}
+	if !binary {
+		encoder := json.NewEncoder(writer)
+		encoder.SetIndent("", " ")
+		return encoder.Encode(model)
+	}
+	if _, err := writer.Write(binaryModelMagic); err != nil {
+		return err
+	}
+	return gob.NewEncoder(writer).Encode(model)
+}
+
+// Read a model file written by WriteModel in either encoding.
+func ReadModel(reader io.Reader) (tagger HMMTagger, err error) {
+	buf_reader := bufio.NewReader(reader)
+	var model modelData
+	if magic, _ := buf_reader.Peek(len(binaryModelMagic)); bytes.Equal(magic, binaryModelMagic) {
+		buf_reader.Discard(len(binaryModelMagic))
+		err = gob.NewDecoder(buf_reader).Decode(&model)
+	} else {
+		err = json.NewDecoder(buf_reader).Decode(&model)
+	}
+	if err != nil {
+		return tagger, ParseError{error: fmt.Sprintf("Model file: %s", err)}
+	}
+	if model.Version != ModelVersion {
+		return tagger, ParseError{error: fmt.Sprintf("Model version %d, expected %d.",
+			model.Version, ModelVersion)}
+	}
+	return taggerFromData(model.Tagger)
+}
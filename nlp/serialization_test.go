@@ -0,0 +1,165 @@
+package nlp
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func Test_ModelRoundTrip(t *testing.T) {
+	corpus, err := TagFormat{}.ReadCorpus(strings.NewReader(tagging_data + tagging_data2))
+	if err != nil {
+		t.Fatalf("Couldn't parse: %s", err)
+	}
+	config := DefaultHmmConfiguration()
+	config.order = 2
+	config.unknown_threshold = 2
+	config.signatures = true
+	config.tag_dictionary = true
+	config.estimators = HMMEstimators{Transition: WittenBellEstimator{}, Emission: AddKEstimator{0.1}}
+	tagger := EstimateFromCorpus(corpus, config)
+	test := Sentence{{word: "The"}, {word: "girl"}, {word: "jumped"}, {word: "."}}
+
+	for _, binary := range []bool{false, true} {
+		var buffer bytes.Buffer
+		if err := WriteModel(&buffer, tagger, binary); err != nil {
+			t.Fatalf("Couldn't write model: %s", err)
+		}
+		loaded, err := ReadModel(&buffer)
+		if err != nil {
+			t.Fatalf("Couldn't read model: %s", err)
+		}
+		for i := 0; i < tagger.Lexicon().WordCount(); i++ {
+			if tagger.Lexicon().words.Type(i) != loaded.Lexicon().words.Type(i) ||
+				tagger.Lexicon().words.TypeIdCount(i) != loaded.Lexicon().words.TypeIdCount(i) {
+				t.Errorf("Word %d changed.", i)
+			}
+		}
+		expected, expected_score, _ := tagger.Tag(test)
+		tagged, score, err := loaded.Tag(test)
+		if err != nil || score != expected_score {
+			t.Errorf("Loaded model scores %f, expected %f (%v).", score, expected_score, err)
+		}
+		if expected.ToTagString() != tagged.ToTagString() {
+			t.Errorf("Loaded model tags %s, expected %s.", tagged.ToTagString(), expected.ToTagString())
+		}
+		if loaded.Configuration() != config {
+			t.Errorf("Loaded configuration %v, expected %v.", loaded.Configuration(), config)
+		}
+	}
+
+	counts := CountsFromCorpus(corpus, 2)
+	encoded, err := json.Marshal(counts)
+	if err != nil {
+		t.Fatalf("Couldn't encode counts: %s", err)
+	}
+	var decoded HMMCounts
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatalf("Couldn't decode counts: %s", err)
+	}
+	if decoded.transitions[decoded.StartHistory()].Total() != 2 {
+		t.Errorf("Counts changed in round trip.")
+	}
+
+	var bad bytes.Buffer
+	bad.WriteString(`{"version": 99}`)
+	if _, err := ReadModel(&bad); err == nil {
+		t.Errorf("Read model with the wrong version.")
+	}
+}
+
+func Test_BadModel(t *testing.T) {
+	corpus, err := TagFormat{}.ReadCorpus(strings.NewReader(tagging_data))
+	if err != nil {
+		t.Fatalf("Couldn't parse: %s", err)
+	}
+	tagger := EstimateFromCorpus(corpus, DefaultHmmConfiguration().WithTagDictionary(1))
+	corruptions := map[string]func(data *hmmTaggerData){
+		"dictionary state": func(data *hmmTaggerData) {
+			data.HMM.Dictionary.All = []State{data.HMM.NumStates}
+		},
+		"dictionary outcome": func(data *hmmTaggerData) {
+			data.HMM.Dictionary.ByOutcome = map[Outcome][]State{0: {data.HMM.NumStates + 3}}
+		},
+		"emission count": func(data *hmmTaggerData) {
+			data.HMM.Emissions = data.HMM.Emissions[1:]
+		},
+		"emission support": func(data *hmmTaggerData) {
+			data.HMM.Emissions[0].Support = 2
+		},
+		"transition key": func(data *hmmTaggerData) {
+			data.HMM.Transitions[0].Distribution = map[int]float64{int(data.HMM.NumStates): 1}
+		},
+		"order": func(data *hmmTaggerData) {
+			data.HMM.Order = 40
+		},
+		"estimator": func(data *hmmTaggerData) {
+			data.Config.Emission = "magic"
+		},
+	}
+	for name, corrupt := range corruptions {
+		data, err := tagger.data()
+		if err != nil {
+			t.Fatalf("Couldn't serialize tagger: %s", err)
+		}
+		corrupt(&data)
+		encoded, err := json.Marshal(modelData{Version: ModelVersion, Tagger: data})
+		if err != nil {
+			t.Fatalf("Couldn't encode model: %s", err)
+		}
+		if _, err := ReadModel(bytes.NewReader(encoded)); err == nil {
+			t.Errorf("Read model with a bad %s.", name)
+		} else if _, ok := err.(ParseError); !ok {
+			t.Errorf("Bad %s gave %T, expected a ParseError.", name, err)
+		}
+	}
+
+	custom := tagger
+	custom.config.estimators.Emission = customEstimator{}
+	if err := WriteModel(&bytes.Buffer{}, custom, false); err == nil {
+		t.Errorf("Wrote a model with an estimator that has no spec.")
+	}
+}
+
+type customEstimator struct {
+	MaximumLikelihoodEstimator
+}
+
+func Test_EstimatorModelRoundTrip(t *testing.T) {
+	corpus, err := TagFormat{}.ReadCorpus(strings.NewReader(tagging_data + tagging_data2))
+	if err != nil {
+		t.Fatalf("Couldn't parse: %s", err)
+	}
+	test := Sentence{{word: "The"}, {word: "girl"}, {word: "jumped"}, {word: "."}}
+	specs := []string{"ml", "laplace", "add-k:0.5", "interpolate:0.8", "witten-bell",
+		"good-turing", "good-turing:2", "absolute:0.5", "kneser-ney:0.75"}
+	for _, spec := range specs {
+		estimator, err := ParseEstimator(spec)
+		if err != nil {
+			t.Fatalf("Couldn't parse %q: %s", spec, err)
+		}
+		for order := 2; order <= 3; order++ {
+			config := DefaultHmmConfiguration().WithOrder(order).
+				WithEstimators(HMMEstimators{Transition: estimator, Emission: estimator})
+			tagger := EstimateFromCorpus(corpus, config)
+			expected, expected_score, _ := tagger.Tag(test)
+			for _, binary := range []bool{false, true} {
+				var buffer bytes.Buffer
+				if err := WriteModel(&buffer, tagger, binary); err != nil {
+					t.Fatalf("%s order %d: couldn't write model: %s", spec, order, err)
+				}
+				loaded, err := ReadModel(&buffer)
+				if err != nil {
+					t.Errorf("%s order %d binary %v: couldn't read model: %s", spec, order, binary, err)
+					continue
+				}
+				tagged, score, _ := loaded.Tag(test)
+				if score != expected_score || tagged.ToTagString() != expected.ToTagString() {
+					t.Errorf("%s order %d binary %v: loaded model tags %s (%f), expected %s (%f).",
+						spec, order, binary, tagged.ToTagString(), score, expected.ToTagString(), expected_score)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package nlp
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+)
+
+type SignificanceConfiguration struct {
+	// Resamples for the bootstrap and shuffles for approximate
+	// randomization.
+	Samples int
+	// Coverage of the confidence intervals.
+	Confidence float64
+	Seed       int64
+}
+
+func DefaultSignificanceConfiguration() SignificanceConfiguration {
+	return SignificanceConfiguration{
+		Samples:    10000,
+		Confidence: 0.95,
+		Seed:       1,
+	}
+}
+
+type Interval struct {
+	Low  float64
+	High float64
+}
+
+// A comparison of two systems on one measure. Difference is B - A.
+type SignificanceResult struct {
+	Name               string
+	A                  float64
+	B                  float64
+	Difference         float64
+	AInterval          Interval
+	BInterval          Interval
+	DifferenceInterval Interval
+	// Two-sided p-values for the null hypothesis of no difference.
+	BootstrapP     float64
+	RandomizationP float64
+}
+
+type Significance struct {
+	GoldName   string
+	AName      string
+	BName      string
+	Samples    int
+	Confidence float64
+	Tags       SignificanceResult
+	Sentences  SignificanceResult
+}
+
+func (significance Significance) Measures() []SignificanceResult {
+	return []SignificanceResult{significance.Tags, significance.Sentences}
+}
+
+// The per-sentence counts the tests resample: correct tags, tags, and
+// correct sentences (0 or 1).
+type sentenceCounts [3]int
+
+// Score each sentence as ScoreTagging does, taking its counts from the
+// change in the scorer's totals.
+func scoreSentences(gold Corpus, test Corpus) []sentenceCounts {
+	counts := make([]sentenceCounts, len(test.sentences))
+	scorer := newTagScorer()
+	for i, test_sentence := range test.sentences {
+		before := scorer.results
+		scorer.add(gold.sentences[i], test_sentence, gold.lexicon, test.lexicon)
+		after := scorer.results
+		counts[i] = sentenceCounts{
+			after.TagsResult.Correct - before.TagsResult.Correct,
+			after.TagsResult.Total - before.TagsResult.Total,
+			after.SentencesResult.Correct - before.SentencesResult.Correct,
+		}
+	}
+	return counts
+}
+
+// Tag and sentence accuracy over the given sentences.
+func accuracies(counts []sentenceCounts, sample []int) (tags float64, sentences float64) {
+	var sum sentenceCounts
+	for _, i := range sample {
+		for k := range sum {
+			sum[k] += counts[i][k]
+		}
+	}
+	if sum[1] > 0 {
+		tags = float64(sum[0]) / float64(sum[1])
+	}
+	if len(sample) > 0 {
+		sentences = float64(sum[2]) / float64(len(sample))
+	}
+	return
+}
+
+func percentileInterval(values []float64, confidence float64) Interval {
+	if len(values) == 0 {
+		return Interval{}
+	}
+	sort.Float64s(values)
+	tail := (1 - confidence) / 2
+	low := int(math.Floor(tail * float64(len(values)-1)))
+	high := int(math.Ceil((1 - tail) * float64(len(values)-1)))
+	return Interval{values[low], values[high]}
+}
+
+// Compare two taggings a and b of the gold corpus with paired bootstrap
+// resampling and approximate randomization over sentences. Both taggings
+// should already have passed CheckSameCorpus against gold.
+func CompareTaggings(gold Corpus, a Corpus, b Corpus, config SignificanceConfiguration) (significance Significance) {
+	significance.Samples = config.Samples
+	significance.Confidence = config.Confidence
+	counts_a := scoreSentences(gold, a)
+	counts_b := scoreSentences(gold, b)
+	n := len(counts_a)
+	if n == 0 {
+		return
+	}
+	all := make([]int, n)
+	for i := range all {
+		all[i] = i
+	}
+	results := [2]*SignificanceResult{&significance.Tags, &significance.Sentences}
+	results[0].Name = "tags"
+	results[1].Name = "sentences"
+	results[0].A, results[1].A = accuracies(counts_a, all)
+	results[0].B, results[1].B = accuracies(counts_b, all)
+	for _, result := range results {
+		result.Difference = result.B - result.A
+	}
+
+	random := rand.New(rand.NewSource(config.Seed))
+	var samples_a, samples_b, samples_diff [2][]float64
+	for k := range results {
+		samples_a[k] = make([]float64, 0, config.Samples)
+		samples_b[k] = make([]float64, 0, config.Samples)
+		samples_diff[k] = make([]float64, 0, config.Samples)
+	}
+	var bootstrap_extreme, randomization_extreme [2]int
+	sample := make([]int, n)
+	shuffled_a := make([]sentenceCounts, n)
+	shuffled_b := make([]sentenceCounts, n)
+	for s := 0; s < config.Samples; s++ {
+		for i := range sample {
+			sample[i] = random.Intn(n)
+		}
+		var a_scores, b_scores [2]float64
+		a_scores[0], a_scores[1] = accuracies(counts_a, sample)
+		b_scores[0], b_scores[1] = accuracies(counts_b, sample)
+		for k, result := range results {
+			difference := b_scores[k] - a_scores[k]
+			samples_a[k] = append(samples_a[k], a_scores[k])
+			samples_b[k] = append(samples_b[k], b_scores[k])
+			samples_diff[k] = append(samples_diff[k], difference)
+			// Under the null hypothesis the bootstrap differences are
+			// centred on zero rather than on the observed difference.
+			if math.Abs(difference-result.Difference) >= math.Abs(result.Difference) {
+				bootstrap_extreme[k]++
+			}
+		}
+
+		// Swap the two systems' outputs on a random half of the sentences.
+		for i := 0; i < n; i++ {
+			if random.Intn(2) == 0 {
+				shuffled_a[i], shuffled_b[i] = counts_a[i], counts_b[i]
+			} else {
+				shuffled_a[i], shuffled_b[i] = counts_b[i], counts_a[i]
+			}
+		}
+		a_scores[0], a_scores[1] = accuracies(shuffled_a, all)
+		b_scores[0], b_scores[1] = accuracies(shuffled_b, all)
+		for k, result := range results {
+			if math.Abs(b_scores[k]-a_scores[k]) >= math.Abs(result.Difference) {
+				randomization_extreme[k]++
+			}
+		}
+	}
+
+	for k, result := range results {
+		result.AInterval = percentileInterval(samples_a[k], config.Confidence)
+		result.BInterval = percentileInterval(samples_b[k], config.Confidence)
+		result.DifferenceInterval = percentileInterval(samples_diff[k], config.Confidence)
+		result.BootstrapP = float64(bootstrap_extreme[k]+1) / float64(config.Samples+1)
+		result.RandomizationP = float64(randomization_extreme[k]+1) / float64(config.Samples+1)
+	}
+	return
+}
@@ -0,0 +1,43 @@
+package nlp
+
+import (
+	"strings"
+	"testing"
+)
+
+func Test_CompareTaggings(t *testing.T) {
+	gold, _ := TagFormat{}.ReadCorpus(strings.NewReader(strings.Repeat(tagging_data, 20)))
+	same, _ := TagFormat{}.ReadCorpus(strings.NewReader(strings.Repeat(tagging_data, 20)))
+	worse, _ := TagFormat{}.ReadCorpus(strings.NewReader(strings.Repeat(
+		"The/DT boy/V walked/N to/IN the/DT store/N ./.\n", 20)))
+	config := DefaultSignificanceConfiguration()
+	config.Samples = 1000
+
+	significance := CompareTaggings(gold, same, worse, config)
+	tags := significance.Tags
+	if tags.A != 1 || tags.B != 5.0/7 || tags.Difference >= 0 {
+		t.Errorf("Tag accuracies: %+v", tags)
+	}
+	if tags.BootstrapP > 0.01 || tags.RandomizationP > 0.01 {
+		t.Errorf("Consistent difference not significant: %+v", tags)
+	}
+	if tags.DifferenceInterval.High >= 0 || tags.AInterval.Low > tags.A || tags.AInterval.High < tags.A {
+		t.Errorf("Intervals: %+v", tags)
+	}
+
+	// The accuracies agree with ScoreTagging.
+	mixed, _ := TagFormat{}.ReadCorpus(strings.NewReader(strings.Repeat(
+		tagging_data+"The/DT boy/V walked/N to/IN the/DT store/N ./.\n", 10)))
+	results := ScoreTagging(gold, mixed)
+	significance = CompareTaggings(gold, same, mixed, config)
+	if significance.Tags.B != results.TagsResult.Percent() ||
+		significance.Sentences.B != results.SentencesResult.Percent() {
+		t.Errorf("Accuracies %f and %f, ScoreTagging gives %f and %f.", significance.Tags.B,
+			significance.Sentences.B, results.TagsResult.Percent(), results.SentencesResult.Percent())
+	}
+
+	significance = CompareTaggings(gold, same, same, config)
+	if p := significance.Tags.RandomizationP; p != 1 {
+		t.Errorf("Identical taggings differ: p = %f", p)
+	}
+}
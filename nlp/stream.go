@@ -0,0 +1,160 @@
+package nlp
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Reads a corpus one sentence at a time. Token ids refer to Lexicon, which
+// grows as sentences are read. Next returns io.EOF after the last sentence.
+type SentenceReader interface {
+	Next() (Sentence, error)
+	Lexicon() *Lexicon
+}
+
+// Implemented by readers of formats with sentence metadata, giving that of
+// the sentence last returned by Next.
+type MetadataReader interface {
+	Metadata() SentenceMetadata
+}
+
+// Writes a corpus one sentence at a time. Output is buffered until Flush.
+type SentenceWriter interface {
+	Write(sentence Sentence) error
+	Flush() error
+}
+
+// Implemented by writers of formats with sentence metadata.
+type MetadataWriter interface {
+	WriteWithMetadata(sentence Sentence, metadata SentenceMetadata) error
+}
+
+// A format that can be read and written a sentence at a time. Every format
+// in the formatter map is one.
+type StreamingFormatter interface {
+	CorpusFormatter
+	NewSentenceReader(reader io.Reader) SentenceReader
+	NewSentenceWriter(writer io.Writer) SentenceWriter
+}
+
+func streamingFormatter(format string) (StreamingFormatter, error) {
+	streaming, ok := Formatter(format).(StreamingFormatter)
+	if !ok {
+		return nil, ParseError{error: fmt.Sprintf("Unknown corpus format: %s", format)}
+	}
+	return streaming, nil
+}
+
+// A reader for the named format, as in the formatter map.
+func NewSentenceReader(reader io.Reader, format string) (SentenceReader, error) {
+	streaming, err := streamingFormatter(format)
+	if err != nil {
+		return nil, err
+	}
+	return streaming.NewSentenceReader(reader), nil
+}
+
+// A writer for the named format, as in the formatter map.
+func NewSentenceWriter(writer io.Writer, format string) (SentenceWriter, error) {
+	streaming, err := streamingFormatter(format)
+	if err != nil {
+		return nil, err
+	}
+	return streaming.NewSentenceWriter(writer), nil
+}
+
+// The metadata of the sentence reader last returned, if it has any.
+func ReaderMetadata(reader SentenceReader) SentenceMetadata {
+	if metadata_reader, ok := reader.(MetadataReader); ok {
+		return metadata_reader.Metadata()
+	}
+	return SentenceMetadata{}
+}
+
+// Write a sentence with its metadata if the writer can hold it, and
+// otherwise without.
+func WriteWithMetadata(writer SentenceWriter, sentence Sentence, metadata SentenceMetadata) error {
+	if metadata_writer, ok := writer.(MetadataWriter); ok {
+		return metadata_writer.WriteWithMetadata(sentence, metadata)
+	}
+	return writer.Write(sentence)
+}
+
+// Read every remaining sentence into a corpus.
+func ReadAll(reader SentenceReader) (corpus Corpus, err error) {
+	corpus.lexicon = reader.Lexicon()
+	metadata_reader, has_metadata := reader.(MetadataReader)
+	for {
+		sentence, err := reader.Next()
+		if err == io.EOF {
+			return corpus, nil
+		}
+		if err != nil {
+			return corpus, err
+		}
+		corpus.sentences = append(corpus.sentences, sentence)
+		if has_metadata {
+			corpus.metadata = append(corpus.metadata, metadata_reader.Metadata())
+		}
+	}
+}
+
+// Write every sentence of a corpus, with metadata, and flush.
+func WriteAll(writer SentenceWriter, corpus Corpus) error {
+	for i, sentence := range corpus.sentences {
+		if err := WriteWithMetadata(writer, sentence, corpus.Metadata(i)); err != nil {
+			return err
+		}
+	}
+	return writer.Flush()
+}
+
+// Reads lines without their line endings, counting them for errors. The
+// last line need not end in a newline.
+type lineReader struct {
+	reader      *bufio.Reader
+	line_number int
+	done        bool
+}
+
+func newLineReader(reader io.Reader) *lineReader {
+	return &lineReader{reader: bufio.NewReader(reader)}
+}
+
+func (reader *lineReader) next() (string, error) {
+	if reader.done {
+		return "", io.EOF
+	}
+	line, err := reader.reader.ReadString('\n')
+	if err == io.EOF {
+		reader.done = true
+		if line == "" {
+			return "", io.EOF
+		}
+	} else if err != nil {
+		return "", err
+	}
+	reader.line_number++
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// Writes each sentence as the text given by format.
+type lineWriter struct {
+	writer *bufio.Writer
+	format func(sentence Sentence) string
+}
+
+func newLineWriter(writer io.Writer, format func(sentence Sentence) string) lineWriter {
+	return lineWriter{bufio.NewWriter(writer), format}
+}
+
+func (writer lineWriter) Write(sentence Sentence) error {
+	_, err := writer.writer.WriteString(writer.format(sentence))
+	return err
+}
+
+func (writer lineWriter) Flush() error {
+	return writer.writer.Flush()
+}
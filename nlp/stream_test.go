@@ -0,0 +1,93 @@
+package nlp
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_SentenceReader(t *testing.T) {
+	inputs := map[string]string{
+		"tag":    tagging_data + tagging_data2,
+		"txt":    "The boy walked\nto the store",
+		"conll":  dep_data + dep_data_wrong,
+		"conllu": conllu_data,
+	}
+	for format, data := range inputs {
+		corpus, err := ReadCorpus(strings.NewReader(data), "corpus."+format)
+		if err != nil {
+			t.Fatalf("%s: couldn't parse: %s", format, err)
+		}
+		reader, err := NewSentenceReader(strings.NewReader(data), format)
+		if err != nil {
+			t.Fatalf("%s: no reader: %s", format, err)
+		}
+		var out bytes.Buffer
+		writer, _ := NewSentenceWriter(&out, format)
+		for i, expected := range corpus.sentences {
+			sentence, err := reader.Next()
+			if err != nil || !reflect.DeepEqual(sentence, expected) {
+				t.Errorf("%s: sentence %d: got %v, %v", format, i, sentence, err)
+			}
+			WriteWithMetadata(writer, sentence, ReaderMetadata(reader))
+		}
+		if _, err := reader.Next(); err != io.EOF {
+			t.Errorf("%s: expected EOF, got %v", format, err)
+		}
+		writer.Flush()
+		var formatted bytes.Buffer
+		Formatter(format).FormatCorpus(corpus, &formatted)
+		if out.String() != formatted.String() {
+			t.Errorf("%s: streamed output differs:\n%s\n%s", format, out.String(), formatted.String())
+		}
+	}
+	if _, err := NewSentenceReader(strings.NewReader(""), "doc"); err == nil {
+		t.Errorf("Reader for unknown format.")
+	}
+}
+
+func Test_ScoreTaggingStream(t *testing.T) {
+	gold_data := tagging_data + tagging_data2
+	test_data := "The/DT boy/N walked/N to/IN the/DT store/N ./.\n" + tagging_data2
+	gold, _ := TagFormat{}.ReadCorpus(strings.NewReader(gold_data))
+	test, _ := TagFormat{}.ReadCorpus(strings.NewReader(test_data))
+	expected := ScoreTagging(gold, test)
+
+	results, err := ScoreTaggingStream(
+		TagFormat{}.NewSentenceReader(strings.NewReader(gold_data)),
+		TagFormat{}.NewSentenceReader(strings.NewReader(test_data)))
+	if err != nil {
+		t.Fatalf("Couldn't score: %s", err)
+	}
+	if !reflect.DeepEqual(results, expected) {
+		t.Errorf("Streamed results differ:\n%+v\n%+v", results, expected)
+	}
+
+	train_data := tagging_data
+	train, _ := TagFormat{}.ReadCorpus(strings.NewReader(train_data))
+	results, err = ScoreTaggingStreamWithTraining(
+		TagFormat{}.NewSentenceReader(strings.NewReader(gold_data)),
+		TagFormat{}.NewSentenceReader(strings.NewReader(test_data)),
+		TagFormat{}.NewSentenceReader(strings.NewReader(train_data)))
+	if err != nil {
+		t.Fatalf("Couldn't score with training: %s", err)
+	}
+	if expected := ScoreTaggingWithTraining(gold, test, train); !reflect.DeepEqual(results, expected) {
+		t.Errorf("Streamed word classes differ:\n%+v\n%+v", results.Words, expected.Words)
+	}
+
+	_, err = ScoreTaggingStream(
+		TagFormat{}.NewSentenceReader(strings.NewReader(gold_data)),
+		TagFormat{}.NewSentenceReader(strings.NewReader(tagging_data)))
+	if _, ok := err.(ScoringError); !ok {
+		t.Errorf("Expected a ScoringError for a short test corpus, got %v", err)
+	}
+	_, err = ScoreTaggingStream(
+		TagFormat{}.NewSentenceReader(strings.NewReader(gold_data)),
+		TagFormat{}.NewSentenceReader(strings.NewReader(tagging_data+tagging_data)))
+	if err == nil || err.Error() != "Sentence 2: Words differ." {
+		t.Errorf("Expected words to differ, got %v", err)
+	}
+}
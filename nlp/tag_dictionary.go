@@ -0,0 +1,88 @@
+package nlp
+
+// Restricts the states Viterbi considers. Each outcome seen at least cutoff
+// times in training may only take the states it was seen with, and each
+// history may only be followed by states seen after it. Other outcomes and
+// histories allow every state.
+type TagDictionary struct {
+	all        []State
+	by_outcome map[Outcome][]State
+	successors map[History][]State
+}
+
+// Build a tag dictionary from training counts. Outcomes seen fewer than
+// cutoff times fall back to the full set of states.
+func NewTagDictionary(counts HMMCounts, cutoff int) TagDictionary {
+	dictionary := TagDictionary{
+		by_outcome: make(map[Outcome][]State),
+		successors: make(map[History][]State),
+	}
+	stop := counts.num_states - 1
+	outcome_counts := make(map[Outcome]float64)
+	var state State
+	for state = 0; state < stop; state++ {
+		dictionary.all = append(dictionary.all, state)
+		for outcome, count := range counts.emissions[state].counts {
+			outcome_counts[Outcome(outcome)] += count
+		}
+	}
+	for state = 0; state < stop; state++ {
+		for outcome, count := range counts.emissions[state].counts {
+			if count > 0 && outcome_counts[Outcome(outcome)] >= float64(cutoff) {
+				dictionary.by_outcome[Outcome(outcome)] =
+					append(dictionary.by_outcome[Outcome(outcome)], state)
+			}
+		}
+	}
+	for history, transition := range counts.transitions {
+		for state = 0; state < stop; state++ {
+			if transition.Count(int(state)) > 0 {
+				dictionary.successors[history] = append(dictionary.successors[history], state)
+			}
+		}
+	}
+	return dictionary
+}
+
+// The states allowed to emit outcome.
+func (dictionary TagDictionary) States(outcome Outcome) []State {
+	if states, ok := dictionary.by_outcome[outcome]; ok {
+		return states
+	}
+	return dictionary.all
+}
+
+// The states allowed to follow history.
+func (dictionary TagDictionary) Successors(history History) []State {
+	if states, ok := dictionary.successors[history]; ok {
+		return states
+	}
+	return dictionary.all
+}
+
+// A copy of the HMM whose Viterbi decoding is pruned by dictionary.
+func (hmm HMM) WithTagDictionary(dictionary TagDictionary) HMM {
+	hmm.dictionary = &dictionary
+	return hmm
+}
+
+// The states to try at a position: those allowed for the outcome, and if
+// prune_transitions is set, also allowed after history. allowed marks the
+// states allowed for the outcome.
+func (dictionary *TagDictionary) candidates(history History, outcome_states []State,
+	allowed []bool, prune_transitions bool) []State {
+	if !prune_transitions {
+		return outcome_states
+	}
+	successors, ok := dictionary.successors[history]
+	if !ok {
+		return outcome_states
+	}
+	candidates := make([]State, 0, len(successors))
+	for _, state := range successors {
+		if allowed[state] {
+			candidates = append(candidates, state)
+		}
+	}
+	return candidates
+}
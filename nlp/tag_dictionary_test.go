@@ -0,0 +1,70 @@
+package nlp
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_TagDictionary(t *testing.T) {
+	corpus, err := TagFormat{}.ReadCorpus(strings.NewReader(tagging_data + tagging_data2))
+	if err != nil {
+		t.Fatalf("Couldn't parse: %s", err)
+	}
+	counts := CountsFromCorpus(corpus, 2)
+	dictionary := NewTagDictionary(counts, 2)
+	boy, _ := corpus.lexicon.LookupWordId("boy")
+	walked, _ := corpus.lexicon.LookupWordId("walked")
+	if states := dictionary.States(Outcome(boy)); len(states) != 1 ||
+		int(states[0]) != corpus.lexicon.GetTagId("N") {
+		t.Errorf("Dictionary states for boy: %v", states)
+	}
+	if states := dictionary.States(Outcome(walked)); len(states) != corpus.lexicon.TagCount() {
+		t.Errorf("Rare word should allow every state: %v", states)
+	}
+
+	hmm := EstimateHMM(counts, HMMEstimators{Transition: WittenBellEstimator{}, Emission: AddKEstimator{1}})
+	pruned := hmm.WithTagDictionary(dictionary)
+	for _, sentence := range corpus.sentences {
+		outcomes := make([]Outcome, len(sentence))
+		for i, token := range sentence {
+			outcomes[i] = Outcome(token.word_id)
+		}
+		score, states := hmm.RunViterbi(outcomes)
+		pruned_score, pruned_states := pruned.RunViterbi(outcomes)
+		if score != pruned_score || !reflect.DeepEqual(states, pruned_states) {
+			t.Errorf("Pruning changed the best path: %f %v, %f %v", score, states, pruned_score, pruned_states)
+		}
+	}
+}
+
+func Test_PrunedTagger(t *testing.T) {
+	corpus, err := TagFormat{}.ReadCorpus(strings.NewReader(tagging_data + tagging_data2))
+	if err != nil {
+		t.Fatalf("Couldn't parse: %s", err)
+	}
+	for order := 1; order <= 3; order++ {
+		config := DefaultHmmConfiguration().WithOrder(order).
+			WithEstimators(HMMEstimators{Transition: WittenBellEstimator{}, Emission: AddKEstimator{1}})
+		tagger := EstimateFromCorpus(corpus, config)
+		pruned := EstimateFromCorpus(corpus, config.WithTagDictionary(2))
+		for _, sentence := range corpus.sentences {
+			expected, expected_score, _ := tagger.Tag(sentence)
+			tagged, score, err := pruned.Tag(sentence)
+			if err != nil || score != expected_score || tagged.ToTagString() != expected.ToTagString() {
+				t.Errorf("Order %d: pruned tagger gives %s (%f), expected %s (%f).", order,
+					tagged.ToTagString(), score, expected.ToTagString(), expected_score)
+			}
+		}
+	}
+}
+
+func Test_TagDictionaryTagger(t *testing.T) {
+	train, dev := readQuestionTreebank(t)
+	config := DefaultHmmConfiguration().WithOrder(3).WithUnknownWords(2, true).
+		WithEstimators(HMMEstimators{Transition: WittenBellEstimator{}, Emission: AddKEstimator{0.01}}).
+		WithTagDictionary(0)
+	if accuracy := devAccuracy(t, train, dev, config); accuracy < 0.9 {
+		t.Errorf("Order 3 with a tag dictionary: dev accuracy %0.3f.", accuracy)
+	}
+}
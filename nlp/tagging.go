@@ -1,10 +1,12 @@
 package nlp
 
 import (
+	"bytes"
+	"strconv"
 	"strings"
 	"fmt"
 	"io"
-	"bufio"
+	"unicode"
 )
 
 type Token struct {
@@ -17,6 +19,17 @@ type Token struct {
 	label_id      int
 	category   string
 	head_index int
+	// Whether HEAD was given, so that CoNLL-U can tell HEAD 0 from "_".
+	has_head   bool
+	// The remaining CoNLL-X columns, kept so that conversions can
+	// round-trip them.
+	lemma      string
+	feats      string
+	phead      string
+	pdeprel    string
+	// The CoNLL-U DEPS and MISC columns.
+	deps       string
+	misc       string
 }
 
 type Sentence []Token
@@ -37,6 +50,19 @@ func newDynamicStringMap() dynamicStringMap {
 	}
 }
 
+func (dsm dynamicStringMap) copy() dynamicStringMap {
+	copied := dynamicStringMap {
+		forward_map: append([]string{}, dsm.forward_map...),
+		reverse_map: make(map[string]int, len(dsm.reverse_map)),
+		counts: append([]int{}, dsm.counts...),
+		counter: dsm.counter,
+	}
+	for typ, id := range dsm.reverse_map {
+		copied.reverse_map[typ] = id
+	}
+	return copied
+}
+
 func (dsm dynamicStringMap) TypesCount() int {
 	return dsm.counter
 }
@@ -49,6 +75,11 @@ func (dsm dynamicStringMap) TypeId(typ string) int {
 	return dsm.reverse_map[typ]
 }
 
+func (dsm dynamicStringMap) LookupTypeId(typ string) (int, bool) {
+	id, ok := dsm.reverse_map[typ]
+	return id, ok
+}
+
 func (dsm dynamicStringMap) Type(id int) string {
 	return dsm.forward_map[id]
 }
@@ -80,6 +111,14 @@ func NewLexicon() *Lexicon {
 	}
 }
 
+func (lexicon Lexicon) Copy() *Lexicon {
+	return &Lexicon{
+		tags: lexicon.tags.copy(),
+		words: lexicon.words.copy(),
+		labels: lexicon.labels.copy(),
+	}
+}
+
 func (lexicon Lexicon) TagCount() int {
 	return lexicon.tags.TypesCount()
 }
@@ -92,6 +131,14 @@ func (lexicon Lexicon) GetTag(tag_id int) string {
 	return lexicon.tags.Type(tag_id)
 }
 
+func (lexicon Lexicon) WordCount() int {
+	return lexicon.words.TypesCount()
+}
+
+func (lexicon Lexicon) LookupWordId(word string) (int, bool) {
+	return lexicon.words.LookupTypeId(word)
+}
+
 func (corpus Corpus) NumSentences() int {
 	return len(corpus.sentences)
 }
@@ -99,6 +146,9 @@ func (corpus Corpus) NumSentences() int {
 type Corpus struct {
 	sentences []Sentence
 	lexicon   *Lexicon
+	// Parallel to sentences for formats that carry sentence metadata, and
+	// otherwise nil.
+	metadata  []SentenceMetadata
 }
 
 func (token Token) Word() string {
@@ -123,11 +173,46 @@ func (result HammingResult) Percent() float64 {
 	return float64(result.Correct) / float64(result.Total)
 }
 
+// The number of confusions listed in TaggingResults.
+const TopConfusionCount = 10
+
 type TaggingResults struct {
 	HammingResult
 	SentencesResult HammingResult
 	TagsResult      HammingResult
 	TagResults      []HammingResult
+	Confusion       ConfusionMatrix
+	TopConfusions   []Confusion
+	// Precision, recall and F1 for every gold tag, in gold lexicon order,
+	// followed by the tags found only in the test corpus.
+	TagPRF       []PRFResult
+	MicroPRF     PRFResult
+	MacroPRF     PRFResult
+	TestOnlyTags []string
+	// Set only when scoring against a training corpus.
+	Words *WordClassResults
+}
+
+// Tag accuracy split by how the word was seen in training: known or
+// unknown, and for known words, ambiguous (seen with more than one tag) or
+// unambiguous.
+type WordClassResults struct {
+	Known       HammingResult
+	Unknown     HammingResult
+	Ambiguous   HammingResult
+	Unambiguous HammingResult
+}
+
+// The results without any per-tag detail, for reporting on hidden test sets.
+func (results TaggingResults) AggregateOnly() TaggingResults {
+	return TaggingResults{
+		HammingResult:   results.HammingResult,
+		SentencesResult: results.SentencesResult,
+		TagsResult:      results.TagsResult,
+		MicroPRF:        results.MicroPRF,
+		MacroPRF:        results.MacroPRF,
+		Words:           results.Words,
+	}
 }
 
 func (result HammingResult) NumIncorrect() int {
@@ -142,14 +227,49 @@ func (err ScoringError) Error() string {
 	return err.error
 }
 
-type ParseError struct {
+type ConversionError struct {
 	error string
 }
 
-func (err ParseError) Error() string {
+func (err ConversionError) Error() string {
 	return err.error
 }
 
+// A malformed input. Line and Column give the 1-based position of the
+// error, or 0 if it is unknown. Column counts fields in CoNLL formats, which
+// also name the field, and tokens in TagFormat.
+type ParseError struct {
+	error       string
+	Line        int
+	Column      int
+	column_name string
+}
+
+func (err ParseError) Error() string {
+	message := err.error
+	if err.Column > 0 {
+		if err.column_name != "" {
+			message = fmt.Sprintf("column %d (%s): %s", err.Column, err.column_name, message)
+		} else {
+			message = fmt.Sprintf("token %d: %s", err.Column, message)
+		}
+	}
+	if err.Line > 0 {
+		message = fmt.Sprintf("Line %d, %s.", err.Line, message)
+	}
+	return message
+}
+
+// Place a reader's error on a line of its input.
+func lineError(line int, err error) ParseError {
+	parse_error, ok := err.(ParseError)
+	if !ok {
+		parse_error = ParseError{error: err.Error()}
+	}
+	parse_error.Line = line
+	return parse_error
+}
+
 func CheckSameSentence(sent1 Sentence, sent2 Sentence) bool {
 	return len(sent1) == len(sent2)
 }
@@ -167,46 +287,217 @@ func CheckSameCorpus(gold Corpus, test Corpus) error {
 	// 	}
 	// }
 	for i, test_sent := range test.sentences {
-		gold_sent := gold.sentences[i]
-		if !CheckSameSentence(gold_sent, test_sent) {
-			return ScoringError{"Sentence size differs."}
+		if err := checkSameSentence(gold.sentences[i], test_sent); err != nil {
+			return err
 		}
-		for j, test_token := range test_sent {
-			gold_token := gold_sent[j]
-			if gold_token.word != test_token.word {
-				return ScoringError{"Words differ."}
-			}
+	}
+	return nil
+}
+
+func checkSameSentence(gold_sent Sentence, test_sent Sentence) error {
+	if !CheckSameSentence(gold_sent, test_sent) {
+		return ScoringError{"Sentence size differs."}
+	}
+	for j, test_token := range test_sent {
+		gold_token := gold_sent[j]
+		if gold_token.word != test_token.word {
+			return ScoringError{"Words differ."}
 		}
 	}
 	return nil
 }
 
-func ScoreTagging(gold Corpus, test Corpus) (results TaggingResults) {
-	results.SentencesResult.Total = len(gold.sentences)
-	results.TagResults = make([]HammingResult, gold.lexicon.TagCount())
-	for i, test_sentence := range test.sentences {
-		gold_sentence := gold.sentences[i]
-		sentence_correct := true
-		for j, test_token := range test_sentence {
-			gold_token := gold_sentence[j]
-
-			results.TagsResult.Total++
-			results.TagResults[gold_token.tag_id].Total++
-			results.TagResults[gold_token.tag_id].Name = gold.lexicon.GetTag(gold_token.tag_id)
-			if gold.lexicon.GetTag(gold_token.tag_id) == test.lexicon.GetTag(test_token.tag_id) {
-				results.TagsResult.Correct++
-				results.TagResults[gold_token.tag_id].Correct++
-			} else {
-				sentence_correct = false
+// Accumulates the counts of ScoreTagging one sentence at a time.
+type tagScorer struct {
+	results TaggingResults
+	// If set, accuracy is also broken down by word class.
+	training *trainingWords
+}
+
+func newTagScorer() *tagScorer {
+	return &tagScorer{results: TaggingResults{Confusion: make(ConfusionMatrix)}}
+}
+
+// The tags each training word was seen with, which is all that scoring by
+// word class needs of the training corpus.
+type trainingWords struct {
+	lexicon *Lexicon
+	tags    map[int]map[int]bool
+}
+
+func newTrainingWords(lexicon *Lexicon) *trainingWords {
+	return &trainingWords{lexicon: lexicon, tags: make(map[int]map[int]bool)}
+}
+
+func (training *trainingWords) add(sentence Sentence) {
+	for _, token := range sentence {
+		if training.tags[token.word_id] == nil {
+			training.tags[token.word_id] = make(map[int]bool)
+		}
+		training.tags[token.word_id][token.tag_id] = true
+	}
+}
+
+// The word class results a gold token counts towards.
+func (training *trainingWords) classes(words *WordClassResults, gold_token Token) []*HammingResult {
+	word_id, ok := training.lexicon.LookupWordId(gold_token.word)
+	if !ok {
+		return []*HammingResult{&words.Unknown}
+	}
+	if len(training.tags[word_id]) > 1 {
+		return []*HammingResult{&words.Known, &words.Ambiguous}
+	}
+	return []*HammingResult{&words.Known, &words.Unambiguous}
+}
+
+func (scorer *tagScorer) scoreWords(training *trainingWords) {
+	scorer.training = training
+	scorer.results.Words = &WordClassResults{
+		Known:       HammingResult{Name: "known"},
+		Unknown:     HammingResult{Name: "unknown"},
+		Ambiguous:   HammingResult{Name: "ambiguous"},
+		Unambiguous: HammingResult{Name: "unambiguous"},
+	}
+}
+
+func (scorer *tagScorer) add(gold_sentence Sentence, test_sentence Sentence, gold_lexicon *Lexicon, test_lexicon *Lexicon) {
+	results := &scorer.results
+	results.SentencesResult.Total++
+	sentence_correct := true
+	for j, test_token := range test_sentence {
+		gold_token := gold_sentence[j]
+		gold_tag := gold_lexicon.GetTag(gold_token.tag_id)
+		test_tag := test_lexicon.GetTag(test_token.tag_id)
+		for len(results.TagResults) <= gold_token.tag_id {
+			results.TagResults = append(results.TagResults, HammingResult{})
+		}
+
+		results.TagsResult.Total++
+		results.TagResults[gold_token.tag_id].Total++
+		results.TagResults[gold_token.tag_id].Name = gold_tag
+		results.Confusion.Inc(gold_tag, test_tag)
+		if gold_tag == test_tag {
+			results.TagsResult.Correct++
+			results.TagResults[gold_token.tag_id].Correct++
+		} else {
+			sentence_correct = false
+		}
+		if scorer.training != nil {
+			for _, class := range scorer.training.classes(results.Words, gold_token) {
+				class.Total++
+				if gold_tag == test_tag {
+					class.Correct++
+				}
 			}
 		}
-		if sentence_correct {
-			results.SentencesResult.Correct++
+	}
+	if sentence_correct {
+		results.SentencesResult.Correct++
+	}
+}
+
+func (scorer *tagScorer) finish(gold_lexicon *Lexicon, test_lexicon *Lexicon) (results TaggingResults) {
+	results = scorer.results
+	for len(results.TagResults) < gold_lexicon.TagCount() {
+		results.TagResults = append(results.TagResults, HammingResult{})
+	}
+	results.TopConfusions = results.Confusion.TopConfusions(TopConfusionCount)
+
+	tags := make([]string, 0, gold_lexicon.TagCount())
+	for tag_id := 0; tag_id < gold_lexicon.TagCount(); tag_id++ {
+		tags = append(tags, gold_lexicon.GetTag(tag_id))
+	}
+	for tag_id := 0; tag_id < test_lexicon.TagCount(); tag_id++ {
+		tag := test_lexicon.GetTag(tag_id)
+		if _, ok := gold_lexicon.tags.LookupTypeId(tag); !ok {
+			tags = append(tags, tag)
+			results.TestOnlyTags = append(results.TestOnlyTags, tag)
 		}
 	}
+	results.TagPRF, results.MicroPRF, results.MacroPRF = results.Confusion.PRF(tags)
+	return
+}
+
+func ScoreTagging(gold Corpus, test Corpus) (results TaggingResults) {
+	return scoreCorpus(newTagScorer(), gold, test)
+}
+
+func scoreCorpus(scorer *tagScorer, gold Corpus, test Corpus) (results TaggingResults) {
+	for i, test_sentence := range test.sentences {
+		scorer.add(gold.sentences[i], test_sentence, gold.lexicon, test.lexicon)
+	}
+	results = scorer.finish(gold.lexicon, test.lexicon)
+	results.SentencesResult.Total = len(gold.sentences)
 	return
 }
 
+// Score as ScoreTagging, reading the gold and test corpora side by side so
+// that only the counts are kept in memory. The corpora are checked as by
+// CheckSameCorpus as they are read.
+func ScoreTaggingStream(gold SentenceReader, test SentenceReader) (results TaggingResults, err error) {
+	return scoreStream(newTagScorer(), gold, test)
+}
+
+func scoreStream(scorer *tagScorer, gold SentenceReader, test SentenceReader) (results TaggingResults, err error) {
+	for i := 1; ; i++ {
+		gold_sentence, gold_err := gold.Next()
+		test_sentence, test_err := test.Next()
+		if gold_err != nil && gold_err != io.EOF {
+			return results, gold_err
+		}
+		if test_err != nil && test_err != io.EOF {
+			return results, test_err
+		}
+		if gold_err == io.EOF && test_err == io.EOF {
+			break
+		}
+		if gold_err == io.EOF || test_err == io.EOF {
+			return results, ScoringError{"Number of sentences differ."}
+		}
+		if err := checkSameSentence(gold_sentence, test_sentence); err != nil {
+			return results, ScoringError{fmt.Sprintf("Sentence %d: %s", i, err)}
+		}
+		scorer.add(gold_sentence, test_sentence, gold.Lexicon(), test.Lexicon())
+	}
+	return scorer.finish(gold.Lexicon(), test.Lexicon()), nil
+}
+
+func (words WordClassResults) List() []HammingResult {
+	return []HammingResult{words.Known, words.Unknown, words.Ambiguous, words.Unambiguous}
+}
+
+// Score as ScoreTagging, also breaking tag accuracy down by whether each
+// word was known or unknown, ambiguous or unambiguous in training.
+func ScoreTaggingWithTraining(gold Corpus, test Corpus, training Corpus) (results TaggingResults) {
+	words := newTrainingWords(training.lexicon)
+	for _, sentence := range training.sentences {
+		words.add(sentence)
+	}
+	scorer := newTagScorer()
+	scorer.scoreWords(words)
+	return scoreCorpus(scorer, gold, test)
+}
+
+// Score as ScoreTaggingWithTraining, reading the corpora a sentence at a
+// time as ScoreTaggingStream does. Only the training words and their tags
+// are kept in memory.
+func ScoreTaggingStreamWithTraining(gold SentenceReader, test SentenceReader, training SentenceReader) (results TaggingResults, err error) {
+	words := newTrainingWords(training.Lexicon())
+	for {
+		sentence, err := training.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return results, err
+		}
+		words.add(sentence)
+	}
+	scorer := newTagScorer()
+	scorer.scoreWords(words)
+	return scoreStream(scorer, gold, test)
+}
+
 type CorpusFormatter interface {
 	// Read in a corpus in this format. 
 	ReadCorpus(reader io.Reader) (corpus Corpus, err error)
@@ -215,76 +506,232 @@ type CorpusFormatter interface {
 	FormatCorpus(corpus Corpus, writer io.Writer)
 }
 
-type TagFormat struct {}
+// Whitespace-separated word/tag tokens, one sentence per line. Each token
+// splits on its last unescaped separator, so words may contain the
+// separator but tags must escape it. The escape string also escapes itself.
+// The zero TagFormat uses "/" and "\\".
+type TagFormat struct {
+	separator string
+	escape    string
+}
 
-func (tag_format TagFormat) ReadSentence(sent string, lexicon *Lexicon) (sentence Sentence, err error) {
-	var word_tag string
-	reader := strings.NewReader(sent)
-	for {
-		_, er := fmt.Fscanf(reader, "%s", &word_tag)
-		if er != nil {
-			break
-		}
-		split_token := strings.Split(word_tag, "/")
-		id := lexicon.tags.UpdateTypeMap(split_token[1])
-		word_id := lexicon.words.UpdateTypeMap(split_token[0])
-		sentence = append(sentence, Token{word: split_token[0], tag_id: id, tag: split_token[1], word_id : word_id})
+func NewTagFormat(separator string, escape string) TagFormat {
+	return TagFormat{separator: separator, escape: escape}
+}
+
+func (tag_format TagFormat) delimiters() (separator string, escape string) {
+	separator, escape = tag_format.separator, tag_format.escape
+	if separator == "" {
+		separator = "/"
+	}
+	if escape == "" {
+		escape = "\\"
 	}
 	return
 }
 
-func (tag_format TagFormat) ReadCorpus(reader io.Reader) (corpus Corpus, err error) {
-	buf_reader := bufio.NewReader(reader)
-	lexicon := NewLexicon()
-	for {
-		sent, err := buf_reader.ReadString('\n')
-		if err != nil {
-			if err == io.EOF {
-				break
-			} else {
-				return corpus, err
-			}
+// Split a token on its last unescaped separator, removing escapes from the
+// word and tag. An escape before anything but the separator or itself is
+// kept literally.
+func (tag_format TagFormat) splitToken(word_tag string) (word string, tag string, err error) {
+	separator, escape := tag_format.delimiters()
+	var parts []string
+	var part bytes.Buffer
+	for i := 0; i < len(word_tag); {
+		rest := word_tag[i:]
+		switch {
+		case strings.HasPrefix(rest, escape+separator):
+			part.WriteString(separator)
+			i += len(escape) + len(separator)
+		case strings.HasPrefix(rest, escape+escape):
+			part.WriteString(escape)
+			i += 2 * len(escape)
+		case strings.HasPrefix(rest, separator):
+			parts = append(parts, part.String())
+			part.Reset()
+			i += len(separator)
+		default:
+			part.WriteByte(word_tag[i])
+			i++
 		}
-		sentence, err := tag_format.ReadSentence(sent, lexicon)
+	}
+	parts = append(parts, part.String())
+	if len(parts) < 2 {
+		return "", "", ParseError{error: fmt.Sprintf("no tag separator %q in %q", separator, word_tag)}
+	}
+	word = strings.Join(parts[:len(parts) - 1], separator)
+	tag = parts[len(parts) - 1]
+	if word == "" {
+		return "", "", ParseError{error: fmt.Sprintf("empty word in %q", word_tag)}
+	}
+	if tag == "" {
+		return "", "", ParseError{error: fmt.Sprintf("empty tag in %q", word_tag)}
+	}
+	return
+}
+
+func (tag_format TagFormat) ReadSentence(sent string, lexicon *Lexicon) (sentence Sentence, err error) {
+	for i, word_tag := range strings.Fields(sent) {
+		word, tag, err := tag_format.splitToken(word_tag)
 		if err != nil {
-			return corpus, err
+			parse_error := err.(ParseError)
+			parse_error.Column = i + 1
+			return nil, parse_error
 		}
-		corpus.sentences = append(corpus.sentences, sentence)
+		id := lexicon.tags.UpdateTypeMap(tag)
+		word_id := lexicon.words.UpdateTypeMap(word)
+		sentence = append(sentence, Token{index: len(sentence) + 1, word: word, tag_id: id, tag: tag, word_id : word_id})
 	}
-	corpus.lexicon = lexicon
 	return
 }
 
-func (token Token) ToTagString() string {
-	return fmt.Sprintf("%s/%s",
-		token.word,
-		token.tag)
+type tagSentenceReader struct {
+	format  TagFormat
+	lines   *lineReader
+	lexicon *Lexicon
 }
 
-func (sentence Sentence) ToTagString() string {
+// Read one sentence per line. Malformed tokens give a ParseError naming the
+// line and token.
+func (tag_format TagFormat) NewSentenceReader(reader io.Reader) SentenceReader {
+	return &tagSentenceReader{tag_format, newLineReader(reader), NewLexicon()}
+}
+
+func (reader *tagSentenceReader) Lexicon() *Lexicon {
+	return reader.lexicon
+}
+
+func (reader *tagSentenceReader) Next() (Sentence, error) {
+	line, err := reader.lines.next()
+	if err != nil {
+		return nil, err
+	}
+	sentence, err := reader.format.ReadSentence(line, reader.lexicon)
+	if err != nil {
+		return nil, lineError(reader.lines.line_number, err)
+	}
+	return sentence, nil
+}
+
+func (tag_format TagFormat) ReadCorpus(reader io.Reader) (corpus Corpus, err error) {
+	return ReadAll(tag_format.NewSentenceReader(reader))
+}
+
+// Write a token, escaping the escape string in its word and tag, and the
+// separator in its tag. Tokens with an empty tag or whitespace in the word
+// do not read back; CheckConversion reports them.
+func (tag_format TagFormat) FormatToken(token Token) string {
+	separator, escape := tag_format.delimiters()
+	escape_escapes := strings.NewReplacer(escape, escape+escape)
+	escape_all := strings.NewReplacer(escape, escape+escape, separator, escape+separator)
+	return escape_escapes.Replace(token.word) + separator + escape_all.Replace(token.tag)
+}
+
+func (tag_format TagFormat) FormatSentence(sentence Sentence) string {
 	words := make([]string, 0)
 	for _, token := range sentence {
-		words = append(words, token.ToTagString())
+		words = append(words, tag_format.FormatToken(token))
 	}
 	return strings.Join(words, " ")
 }
 
+func (token Token) ToTagString() string {
+	return TagFormat{}.FormatToken(token)
+}
+
+func (sentence Sentence) ToTagString() string {
+	return TagFormat{}.FormatSentence(sentence)
+}
+
+func (format TagFormat) NewSentenceWriter(writer io.Writer) SentenceWriter {
+	return newLineWriter(writer, func(sentence Sentence) string {
+		return format.FormatSentence(sentence) + "\n"
+	})
+}
+
 func (format TagFormat) FormatCorpus(corpus Corpus, writer io.Writer) {
-	for _, sent := range corpus.sentences {
-		fmt.Fprintf(writer, "%s\n", sent.ToTagString())
+	WriteAll(format.NewSentenceWriter(writer), corpus)
+}
+
+// Untagged text, one sentence per line with words separated by whitespace.
+// Any tags on the corpus are dropped when writing.
+type TextFormat struct {}
+
+type textSentenceReader struct {
+	lines   *lineReader
+	lexicon *Lexicon
+}
+
+func (format TextFormat) NewSentenceReader(reader io.Reader) SentenceReader {
+	return &textSentenceReader{newLineReader(reader), NewLexicon()}
+}
+
+func (reader *textSentenceReader) Lexicon() *Lexicon {
+	return reader.lexicon
+}
+
+func (reader *textSentenceReader) Next() (sentence Sentence, err error) {
+	line, err := reader.lines.next()
+	if err != nil {
+		return nil, err
 	}
+	for _, word := range strings.Fields(line) {
+		word_id := reader.lexicon.words.UpdateTypeMap(word)
+		sentence = append(sentence, Token{index: len(sentence) + 1, word: word, word_id: word_id})
+	}
+	return sentence, nil
+}
+
+func (format TextFormat) ReadCorpus(reader io.Reader) (corpus Corpus, err error) {
+	return ReadAll(format.NewSentenceReader(reader))
+}
+
+func (format TextFormat) NewSentenceWriter(writer io.Writer) SentenceWriter {
+	return newLineWriter(writer, func(sentence Sentence) string {
+		words := make([]string, len(sentence))
+		for i, token := range sentence {
+			words[i] = token.word
+		}
+		return strings.Join(words, " ") + "\n"
+	})
+}
+
+func (format TextFormat) FormatCorpus(corpus Corpus, writer io.Writer) {
+	WriteAll(format.NewSentenceWriter(writer), corpus)
 }
 
 type CoNLLFormat struct {} 
 
+// CoNLL marks missing fields with an underscore.
+func conllField(field string) string {
+	if field == "" {
+		return "_"
+	}
+	return field
+}
+
+// The HEAD column, with an underscore for tokens read without a head.
+func conllHead(token Token) string {
+	if token.has_head || token.head_index != 0 {
+		return strconv.Itoa(token.head_index)
+	}
+	return "_"
+}
+
+// CoNLL-X columns are tab separated, so that CoNLLFormat.NewSentenceReader,
+// which splits on tabs, and other CoNLL tools can read the output back.
 func (token Token) ToCoNLLString() string {
-	return fmt.Sprintf("%d %s _ %s %s _ %d %s _ _",
+	return fmt.Sprintf("%d\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s",
 		token.index,
 		token.word,
-		token.category,
-		token.tag,
-		token.head_index,
-		token.label)
+		conllField(token.lemma),
+		conllField(token.category),
+		conllField(token.tag),
+		conllField(token.feats),
+		conllHead(token),
+		conllField(token.label),
+		conllField(token.phead),
+		conllField(token.pdeprel))
 }
 
 func (sentence Sentence) ToCoNLLString() string {
@@ -295,73 +742,273 @@ func (sentence Sentence) ToCoNLLString() string {
 	return strings.Join(words, "\n")
 }
 
+var conllColumns = []string{"ID", "FORM", "LEMMA", "CPOSTAG", "POSTAG", "FEATS", "HEAD", "DEPREL", "PHEAD", "PDEPREL"}
+
+func columnError(columns []string, column int, format string, args ...interface{}) ParseError {
+	return ParseError{error: fmt.Sprintf(format, args...), Column: column + 1, column_name: columns[column]}
+}
+
+func conllColumnError(column int, format string, args ...interface{}) ParseError {
+	return columnError(conllColumns, column, format, args...)
+}
+
+// The value of an optional field, with CoNLL's underscore read as empty.
+func conllValue(field string) string {
+	if field == "_" {
+		return ""
+	}
+	return field
+}
+
+// Read one token line of ten tab-separated columns. Fields may contain
+// spaces. A HEAD of "_" reads as 0 and is written back as "_".
 func (format CoNLLFormat) ReadToken(line string, lexicon *Lexicon) (token Token, err error) {
-	var temp string
-	fmt.Sscanf(line, "%d %s %s %s %s %s %d %s %s %s",
-		&token.index,
-		&token.word,
-		&temp,
-		&token.category,
-		&token.tag,
-		&temp,
-		&token.head_index,
-		&token.label,
-		&temp,
-		&temp)
+	fields := strings.Split(strings.TrimRight(line, "\r\n"), "\t")
+	if len(fields) != len(conllColumns) {
+		return token, ParseError{error: fmt.Sprintf("expected %d tab-separated columns, found %d", len(conllColumns), len(fields))}
+	}
+	for i, field := range fields {
+		if field == "" {
+			return token, conllColumnError(i, "empty field")
+		}
+	}
+	if token.index, err = strconv.Atoi(fields[0]); err != nil || token.index < 1 {
+		return token, conllColumnError(0, "expected a positive integer, found %q", fields[0])
+	}
+	if fields[6] != "_" {
+		if token.head_index, err = strconv.Atoi(fields[6]); err != nil || token.head_index < 0 {
+			return token, conllColumnError(6, "expected a head index, found %q", fields[6])
+		}
+		token.has_head = true
+	}
+	token.word = fields[1]
+	token.lemma = conllValue(fields[2])
+	token.category = conllValue(fields[3])
+	token.tag = conllValue(fields[4])
+	token.feats = conllValue(fields[5])
+	token.label = conllValue(fields[7])
+	token.phead = conllValue(fields[8])
+	token.pdeprel = conllValue(fields[9])
 	token.tag_id = lexicon.tags.UpdateTypeMap(token.tag)
 	token.word_id = lexicon.words.UpdateTypeMap(token.word)
 	token.label_id = lexicon.labels.UpdateTypeMap(token.label)
 	return
 }
 
+func (format CoNLLFormat) NewSentenceWriter(writer io.Writer) SentenceWriter {
+	return newLineWriter(writer, func(sentence Sentence) string {
+		return sentence.ToCoNLLString() + "\n\n"
+	})
+}
+
 func (format CoNLLFormat) FormatCorpus(corpus Corpus, writer io.Writer) {
-	for _, sent := range corpus.sentences{
-		fmt.Fprintf(writer, "%s\n\n", sent.ToCoNLLString())
-	}
+	WriteAll(format.NewSentenceWriter(writer), corpus)
 }
 
-func (format CoNLLFormat) ReadCorpus(reader io.Reader) (corpus Corpus, err error) {
-	buf_reader := bufio.NewReader(reader)
-	lexicon := NewLexicon()
-	var sentence Sentence
+type conllSentenceReader struct {
+	format  CoNLLFormat
+	lines   *lineReader
+	lexicon *Lexicon
+}
+
+// Read sentences of token lines separated by blank lines. Lines may end in
+// CRLF, lines starting with # are comments, and the last sentence need not
+// be followed by a blank line. Malformed lines give a ParseError naming the
+// line and column.
+func (format CoNLLFormat) NewSentenceReader(reader io.Reader) SentenceReader {
+	return &conllSentenceReader{format, newLineReader(reader), NewLexicon()}
+}
+
+func (reader *conllSentenceReader) Lexicon() *Lexicon {
+	return reader.lexicon
+}
+
+func (reader *conllSentenceReader) Next() (sentence Sentence, err error) {
 	for {
-		line, err := buf_reader.ReadString('\n')
-		if line == "\n" {
-			corpus.sentences = append(corpus.sentences, sentence)
-			sentence = make(Sentence, 0)
-			continue
+		line, err := reader.lines.next()
+		if err == io.EOF && len(sentence) > 0 {
+			return sentence, nil
 		}
 		if err != nil {
-			if err == io.EOF {
-				break
-			} else {
-				return corpus, err
-			}
+			return nil, err
 		}
-		token, err := format.ReadToken(line, lexicon)
-		sentence = append(sentence, token)
-		if err != nil {
-			return corpus, err
+		switch {
+		case strings.TrimSpace(line) == "":
+			if len(sentence) > 0 {
+				return sentence, nil
+			}
+		case strings.HasPrefix(line, "#"):
+		default:
+			token, err := reader.format.ReadToken(line, reader.lexicon)
+			if err == nil && token.index != len(sentence) + 1 {
+				err = conllColumnError(0, "expected token %d, found %d", len(sentence) + 1, token.index)
+			}
+			if err != nil {
+				return nil, lineError(reader.lines.line_number, err)
+			}
+			sentence = append(sentence, token)
 		}
 	}
-	corpus.lexicon = lexicon
+}
+
+func (format CoNLLFormat) ReadCorpus(reader io.Reader) (corpus Corpus, err error) {
+	return ReadAll(format.NewSentenceReader(reader))
+}
+
+// Formats that cannot hold every token field list the fields a token would
+// lose when written.
+type lossyFormatter interface {
+	droppedFields(token Token) []string
+}
+
+func (format TagFormat) droppedFields(token Token) (dropped []string) {
+	if token.tag == "" {
+		dropped = append(dropped, "empty tags")
+	}
+	return append(dropped, annotationDropped(token)...)
+}
+
+// The fields of token that neither TagFormat nor TextFormat can write.
+// Tokens are separated by whitespace, so words cannot contain any.
+func annotationDropped(token Token) (dropped []string) {
+	if strings.IndexFunc(token.word, unicode.IsSpace) >= 0 {
+		dropped = append(dropped, "words with whitespace")
+	}
+	if token.category != "" {
+		dropped = append(dropped, "coarse tags")
+	}
+	if token.has_head || token.head_index != 0 {
+		dropped = append(dropped, "heads")
+	}
+	if token.label != "" {
+		dropped = append(dropped, "labels")
+	}
+	if token.lemma != "" {
+		dropped = append(dropped, "lemmas")
+	}
+	if token.feats != "" {
+		dropped = append(dropped, "features")
+	}
+	if token.phead != "" || token.pdeprel != "" {
+		dropped = append(dropped, "projective heads")
+	}
+	return append(dropped, CoNLLFormat{}.droppedFields(token)...)
+}
+
+func (format CoNLLFormat) droppedFields(token Token) (dropped []string) {
+	if token.deps != "" {
+		dropped = append(dropped, "enhanced dependencies")
+	}
+	if token.misc != "" {
+		dropped = append(dropped, "misc fields")
+	}
 	return
 }
 
+func (format TextFormat) droppedFields(token Token) (dropped []string) {
+	if token.tag != "" {
+		dropped = append(dropped, "tags")
+	}
+	return append(dropped, annotationDropped(token)...)
+}
+
+// Check that writing corpus with formatter keeps all of its annotation.
+// Returns a ConversionError naming the first token that would lose fields.
+func CheckConversion(corpus Corpus, formatter CorpusFormatter) error {
+	for i, sentence := range corpus.sentences {
+		if err := CheckSentenceConversion(i + 1, sentence, corpus.Metadata(i), formatter); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Check that writing sentence number index with formatter keeps all of its
+// annotation, as CheckConversion does for a whole corpus.
+func CheckSentenceConversion(index int, sentence Sentence, metadata SentenceMetadata, formatter CorpusFormatter) error {
+	if _, ok := formatter.(CoNLLUFormat); !ok && !metadata.empty() {
+		return ConversionError{fmt.Sprintf(
+			"Sentence %d: output format cannot represent comments, multiword tokens or empty nodes.",
+			index)}
+	}
+	lossy, ok := formatter.(lossyFormatter)
+	if !ok {
+		return nil
+	}
+	for j, token := range sentence {
+		if dropped := lossy.droppedFields(token); len(dropped) > 0 {
+			return ConversionError{fmt.Sprintf(
+				"Sentence %d, token %d: output format cannot represent %s.",
+				index, j + 1, strings.Join(dropped, ", "))}
+		}
+	}
+	return nil
+}
+
+// Check that converting between the two formats keeps the tag in a column
+// of the same kind. The CoNLL-X tag is the fine-grained POSTAG, so it only
+// converts to and from CoNLL-U that takes XPOS as the tag.
+func CheckFormatConversion(input CorpusFormatter, output CorpusFormatter) error {
+	swapped := func(from, to CorpusFormatter) bool {
+		_, conll := from.(CoNLLFormat)
+		conllu, ok := to.(CoNLLUFormat)
+		return conll && ok && !conllu.xpos
+	}
+	if swapped(input, output) || swapped(output, input) {
+		return ConversionError{"CoNLL-X POSTAG and CPOSTAG would be exchanged with CoNLL-U UPOS and XPOS; use conllu:xpos to keep POSTAG in XPOS."}
+	}
+	return nil
+}
+
+// Read a corpus in the format given by the file name's extension.
 func ReadCorpus(reader io.Reader, file_name string) (corpus Corpus, err error) {
 	formatter := FormatterFromFile(file_name)
+	if formatter == nil {
+		return corpus, ParseError{error: fmt.Sprintf("Unknown corpus format: %s", file_name)}
+	}
 	return formatter.ReadCorpus(reader)
 }
 
 var formatter = map[string]CorpusFormatter {
 	"conll" : CoNLLFormat{},
+	"conllu" : CoNLLUFormat{},
 	"tag" : TagFormat{},
+	"txt" : TextFormat{},
 }
 
+// The format with the given name, or nil. A TagFormat with another
+// separator and escape is named "tag:SEP" or "tag:SEP:ESC", as in "tag:_".
+// CoNLL-U taking XPOS as the tag is "conllu:xpos"; "conllu:upos" is the
+// same as "conllu".
 func Formatter(formatter_string string) CorpusFormatter {
+	if strings.HasPrefix(formatter_string, "tag:") {
+		return tagFormatFromSpec(strings.TrimPrefix(formatter_string, "tag:"))
+	}
+	if strings.HasPrefix(formatter_string, "conllu:") {
+		return conlluFormatFromSpec(strings.TrimPrefix(formatter_string, "conllu:"))
+	}
 	return formatter[formatter_string]
 }
 
+// The separator and escape must be distinct, non-empty and free of
+// whitespace, which separates tokens.
+func tagFormatFromSpec(spec string) CorpusFormatter {
+	options := strings.Split(spec, ":")
+	if len(options) > 2 || (len(options) == 2 && options[0] == options[1]) {
+		return nil
+	}
+	for _, option := range options {
+		if option == "" || strings.IndexFunc(option, unicode.IsSpace) >= 0 {
+			return nil
+		}
+	}
+	format := TagFormat{separator: options[0]}
+	if len(options) == 2 {
+		format.escape = options[1]
+	}
+	return format
+}
+
 func FormatterFromFile(file_name string) CorpusFormatter {
 	split := strings.Split(file_name, ".")
 	return Formatter(split[len(split) - 1])
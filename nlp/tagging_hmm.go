@@ -1,11 +1,191 @@
 package nlp
 
+import (
+	"fmt"
+)
+
 type HmmConfiguration struct {
+	// Words seen fewer times than this in training are replaced by UNK
+	// classes.
 	unknown_threshold int
+	// Use word signatures rather than a single UNK class.
+	signatures bool
 	order int
+	estimators HMMEstimators
+	// Prune Viterbi with a tag dictionary. Words seen fewer than
+	// dictionary_cutoff times may take any tag.
+	tag_dictionary bool
+	dictionary_cutoff int
+}
+
+func DefaultHmmConfiguration() HmmConfiguration {
+	return HmmConfiguration{
+		unknown_threshold: 0,
+		order: 1,
+	}
+}
+
+func (config HmmConfiguration) WithOrder(order int) HmmConfiguration {
+	config.order = order
+	return config
+}
+
+// Replace words seen fewer than threshold times with UNK, or with their
+// signatures if signatures is set.
+func (config HmmConfiguration) WithUnknownWords(threshold int, signatures bool) HmmConfiguration {
+	config.unknown_threshold = threshold
+	config.signatures = signatures
+	return config
+}
+
+func (config HmmConfiguration) WithEstimators(estimators HMMEstimators) HmmConfiguration {
+	config.estimators = estimators
+	return config
+}
+
+// Prune decoding with a tag dictionary built from training words seen at
+// least cutoff times. A cutoff of 0 or 1 restricts every training word,
+// even those seen once, to its training tags.
+func (config HmmConfiguration) WithTagDictionary(cutoff int) HmmConfiguration {
+	config.tag_dictionary = true
+	config.dictionary_cutoff = cutoff
+	return config
+}
+
+// An HMM tagger together with the lexicon mapping its states onto tags and
+// its outcomes onto words. State i is the tag with id i, and the final state
+// is STOP. Words pass through mapper before lookup in the lexicon.
+type HMMTagger struct {
+	hmm     HMM
+	lexicon *Lexicon
+	mapper  WordMapper
+	config  HmmConfiguration
+}
+
+func (tagger HMMTagger) HMM() HMM {
+	return tagger.hmm
+}
+
+func (tagger HMMTagger) Lexicon() *Lexicon {
+	return tagger.lexicon
 }
 
-//func EstimateFromCorpus(corpus Corpus) HMM{
-	//tag_counts := corpus.tags.TypeCount()
-	//word_counts := corpus.words.TypeCount()
-//}
\ No newline at end of file
+// The settings the tagger was trained with, for retraining on new data.
+func (tagger HMMTagger) Configuration() HmmConfiguration {
+	return tagger.config
+}
+
+// Count transitions and emissions in a tagged corpus. Tag ids become states,
+// word ids become outcomes, and every sentence ends with a transition to an
+// extra STOP state. Transitions condition on the previous order states.
+func CountsFromCorpus(corpus Corpus, order int) HMMCounts {
+	num_tags := corpus.lexicon.TagCount()
+	counts := NewHMMCounts(num_tags + 1, corpus.lexicon.WordCount(), order)
+	stop := State(num_tags)
+	for _, sentence := range corpus.sentences {
+		if len(sentence) == 0 {
+			continue
+		}
+		history := counts.StartHistory()
+		for _, token := range sentence {
+			state := State(token.tag_id)
+			counts.IncTransition(history, state)
+			counts.IncEmission(state, Outcome(token.word_id))
+			history = counts.Extend(history, state)
+		}
+		counts.IncTransition(history, stop)
+	}
+	return counts
+}
+
+// Check that an HMM estimated from corpus with this configuration is within
+// MaxTransitions. EstimateFromCorpus does not check, so call this first
+// when the order or tag set comes from a user.
+func (config HmmConfiguration) CheckSize(corpus Corpus) error {
+	order := config.order
+	if order < 1 {
+		order = 1
+	}
+	return CheckHMMSize(State(corpus.lexicon.TagCount() + 1), order)
+}
+
+func EstimateFromCorpus(corpus Corpus, config HmmConfiguration) HMMTagger {
+	if config.order < 1 {
+		config.order = 1
+	}
+	mapper := NewWordMapper(corpus.lexicon, config.unknown_threshold, config.signatures)
+	if config.unknown_threshold > 0 {
+		corpus = mapper.MapCorpus(corpus)
+	}
+	counts := CountsFromCorpus(corpus, config.order)
+	hmm := EstimateHMM(counts, config.estimators)
+	if config.tag_dictionary {
+		hmm = hmm.WithTagDictionary(NewTagDictionary(counts, config.dictionary_cutoff))
+	}
+	return HMMTagger{
+		hmm:     hmm,
+		lexicon: corpus.lexicon,
+		mapper:  mapper,
+		config:  config,
+	}
+}
+
+// Map the words of a sentence onto outcomes. Words missing from the lexicon
+// after UNK replacement map to an outcome one past the last known word.
+func (tagger HMMTagger) Outcomes(sentence Sentence) []Outcome {
+	outcomes := make([]Outcome, len(sentence))
+	for i, token := range sentence {
+		if word_id, ok := tagger.lexicon.LookupWordId(tagger.mapper.Map(token.word)); ok {
+			outcomes[i] = Outcome(word_id)
+		} else {
+			outcomes[i] = Outcome(tagger.lexicon.WordCount())
+		}
+	}
+	return outcomes
+}
+
+type TaggingError struct {
+	error string
+}
+
+func (err TaggingError) Error() string {
+	return err.error
+}
+
+// Tag a sentence with its most likely tag sequence. Returns a copy of the
+// sentence with tags and tag ids taken from the tagger's lexicon, along with
+// the log-probability of the tagging.
+func (tagger HMMTagger) Tag(sentence Sentence) (Sentence, float64, error) {
+	score, states := tagger.hmm.RunViterbi(tagger.Outcomes(sentence))
+	if states == nil && len(sentence) > 0 {
+		return nil, score, TaggingError{"No tagging has nonzero probability."}
+	}
+	tagged := make(Sentence, len(sentence))
+	for i, token := range sentence {
+		token.tag_id = int(states[i])
+		token.tag = tagger.lexicon.GetTag(token.tag_id)
+		tagged[i] = token
+	}
+	return tagged, score, nil
+}
+
+// Tag every sentence of a corpus. The tagged corpus gets a fresh lexicon
+// built from its own words and predicted tags.
+func (tagger HMMTagger) TagCorpus(corpus Corpus) (tagged Corpus, err error) {
+	lexicon := NewLexicon()
+	for i, sentence := range corpus.sentences {
+		tagged_sentence, _, err := tagger.Tag(sentence)
+		if err != nil {
+			return tagged, TaggingError{fmt.Sprintf("Sentence %d: %s", i + 1, err)}
+		}
+		for j, token := range tagged_sentence {
+			tagged_sentence[j].word_id = lexicon.words.UpdateTypeMap(token.word)
+			tagged_sentence[j].tag_id = lexicon.tags.UpdateTypeMap(token.tag)
+			tagged_sentence[j].label_id = lexicon.labels.UpdateTypeMap(token.label)
+		}
+		tagged.sentences = append(tagged.sentences, tagged_sentence)
+	}
+	tagged.lexicon = lexicon
+	tagged.metadata = corpus.metadata
+	return
+}
@@ -0,0 +1,294 @@
+package nlp
+
+import (
+	"math"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func Test_EstimateFromCorpus(t *testing.T) {
+	corpus, err := TagFormat{}.ReadCorpus(strings.NewReader(tagging_data + tagging_data2))
+	if err != nil {
+		t.Fatalf("Couldn't parse: %s", err)
+	}
+	tagger := EstimateFromCorpus(corpus, DefaultHmmConfiguration())
+	hmm := tagger.HMM()
+	lexicon := tagger.Lexicon()
+	if n := hmm.NumStates(); int(n) != lexicon.TagCount() + 1 {
+		t.Errorf("Expected a STOP state, got %d states.", n)
+	}
+	dt := State(lexicon.GetTagId("DT"))
+	n := State(lexicon.GetTagId("N"))
+	period := State(lexicon.GetTagId("."))
+	if p := hmm.ProbStart(dt); p != 1.0 {
+		t.Errorf("Start probability wrong: %f", p)
+	}
+	if p := hmm.ProbTransition(History(dt), n); p != 1.0 {
+		t.Errorf("Transition probability wrong: %f", p)
+	}
+	if p := hmm.ProbTransition(History(period), hmm.Stop()); p != 1.0 {
+		t.Errorf("Stop probability wrong: %f", p)
+	}
+	walked, _ := lexicon.LookupWordId("walked")
+	v := State(lexicon.GetTagId("V"))
+	if p := hmm.ProbEmission(v, Outcome(walked)); p != 0.5 {
+		t.Errorf("Emission probability wrong: %f", p)
+	}
+	outcomes := tagger.Outcomes(Sentence{{word: "boy"}, {word: "ran"}})
+	if int(outcomes[1]) != lexicon.WordCount() {
+		t.Errorf("Unknown word outcome wrong: %d", outcomes[1])
+	}
+}
+
+func Test_CheckSize(t *testing.T) {
+	if err := CheckHMMSize(46, 3); err != nil {
+		t.Errorf("45 tags and order 3 refused: %s", err)
+	}
+	if _, ok := CheckHMMSize(46, 4).(ModelError); !ok {
+		t.Errorf("45 tags and order 4 allowed.")
+	}
+	if _, ok := CheckHMMSize(2, 1000).(ModelError); !ok {
+		t.Errorf("Order 1000 allowed.")
+	}
+	corpus, err := TagFormat{}.ReadCorpus(strings.NewReader(tagging_data))
+	if err != nil {
+		t.Fatalf("Couldn't parse: %s", err)
+	}
+	if err := DefaultHmmConfiguration().WithOrder(3).CheckSize(corpus); err != nil {
+		t.Errorf("Small corpus refused: %s", err)
+	}
+	if err := DefaultHmmConfiguration().WithOrder(40).CheckSize(corpus); err == nil {
+		t.Errorf("Order 40 allowed.")
+	}
+}
+
+func Test_HigherOrderViterbi(t *testing.T) {
+	corpus, err := TagFormat{}.ReadCorpus(strings.NewReader(tagging_data + tagging_data2))
+	if err != nil {
+		t.Fatalf("Couldn't parse: %s", err)
+	}
+	for order := 1; order <= 3; order++ {
+		config := DefaultHmmConfiguration()
+		config.order = order
+		tagger := EstimateFromCorpus(corpus, config)
+		sentence := corpus.sentences[0]
+		_, states := tagger.HMM().RunViterbi(tagger.Outcomes(sentence))
+		if len(states) != len(sentence) {
+			t.Fatalf("Order %d: path length %d.", order, len(states))
+		}
+		for i, token := range sentence {
+			if int(states[i]) != token.tag_id {
+				t.Errorf("Order %d: position %d tagged %d, expected %d.",
+					order, i, states[i], token.tag_id)
+			}
+		}
+	}
+}
+
+func randomHMM(order int, seed int64) HMM {
+	random := rand.New(rand.NewSource(seed))
+	num_tags := 3
+	counts := NewHMMCounts(num_tags + 1, 3, order)
+	for i := 0; i < 200; i++ {
+		history := counts.StartHistory()
+		length := random.Intn(4) + 1
+		for j := 0; j < length; j++ {
+			state := State(random.Intn(num_tags))
+			counts.IncTransition(history, state)
+			counts.IncEmission(state, Outcome(random.Intn(3)))
+			history = counts.Extend(history, state)
+		}
+		counts.IncTransition(history, State(num_tags))
+	}
+	return MaximumLikelihoodHMM(counts)
+}
+
+func Test_ViterbiMatchesBruteForce(t *testing.T) {
+	outcomes := []Outcome{2, 0, 1, 1}
+	for order := 1; order <= 3; order++ {
+		hmm := randomHMM(order, int64(order))
+		best := math.Inf(-1)
+		states := make([]State, len(outcomes))
+		var enumerate func(position int)
+		enumerate = func(position int) {
+			if position == len(outcomes) {
+				best = math.Max(best, hmm.LogProbPath(outcomes, states))
+				return
+			}
+			var state State
+			for state = 0; state < hmm.Stop(); state++ {
+				states[position] = state
+				enumerate(position + 1)
+			}
+		}
+		enumerate(0)
+
+		score, path := hmm.RunViterbi(outcomes)
+		if math.Abs(score - best) > 1e-9 {
+			t.Errorf("Order %d: Viterbi score %f, best path %f.", order, score, best)
+		}
+		if p := hmm.LogProbPath(outcomes, path); math.Abs(score - p) > 1e-9 {
+			t.Errorf("Order %d: Viterbi path scores %f, reported %f.", order, p, score)
+		}
+	}
+}
+
+func Test_TagCorpus(t *testing.T) {
+	corpus, err := TagFormat{}.ReadCorpus(strings.NewReader(tagging_data + tagging_data2))
+	if err != nil {
+		t.Fatalf("Couldn't parse: %s", err)
+	}
+	tagger := EstimateFromCorpus(corpus, DefaultHmmConfiguration())
+	tagged, err := tagger.TagCorpus(corpus)
+	if err != nil {
+		t.Fatalf("Couldn't tag: %s", err)
+	}
+	results := ScoreTagging(corpus, tagged)
+	if results.TagsResult.NumIncorrect() != 0 {
+		t.Errorf("Tagging training data made %d errors.", results.TagsResult.NumIncorrect())
+	}
+}
+
+func Test_ForwardBackward(t *testing.T) {
+	outcomes := []Outcome{2, 0, 1, 1}
+	for order := 1; order <= 3; order++ {
+		hmm := randomHMM(order, int64(order))
+		total := math.Inf(-1)
+		marginals := make([][]float64, len(outcomes))
+		for i := range marginals {
+			marginals[i] = make([]float64, hmm.Stop())
+		}
+		states := make([]State, len(outcomes))
+		var enumerate func(position int)
+		enumerate = func(position int) {
+			if position == len(outcomes) {
+				score := hmm.LogProbPath(outcomes, states)
+				total = logAdd(total, score)
+				for i, state := range states {
+					marginals[i][state] += math.Exp(score)
+				}
+				return
+			}
+			var state State
+			for state = 0; state < hmm.Stop(); state++ {
+				states[position] = state
+				enumerate(position + 1)
+			}
+		}
+		enumerate(0)
+
+		posteriors, log_likelihood := hmm.Posteriors(outcomes)
+		if math.Abs(log_likelihood - total) > 1e-9 {
+			t.Errorf("Order %d: likelihood %f, brute force %f.", order, log_likelihood, total)
+		}
+		for i := range outcomes {
+			for s, p := range posteriors[i] {
+				if expected := marginals[i][s] / math.Exp(total); math.Abs(p - expected) > 1e-9 {
+					t.Errorf("Order %d: posterior (%d, %d) %f, expected %f.", order, i, s, p, expected)
+				}
+			}
+		}
+	}
+
+	// Long inputs should not underflow.
+	hmm := randomHMM(2, 7)
+	long := make([]Outcome, 2000)
+	for i := range long {
+		long[i] = Outcome(i % 3)
+	}
+	posteriors, log_likelihood := hmm.Posteriors(long)
+	if math.IsInf(log_likelihood, 0) || math.IsNaN(log_likelihood) {
+		t.Fatalf("Long likelihood underflowed: %f", log_likelihood)
+	}
+	for i, row := range posteriors {
+		sum := 0.0
+		for _, p := range row {
+			sum += p
+		}
+		if math.Abs(sum - 1.0) > 1e-6 {
+			t.Fatalf("Posteriors at %d sum to %f.", i, sum)
+		}
+	}
+}
+
+func Test_BaumWelch(t *testing.T) {
+	random := rand.New(rand.NewSource(3))
+	sentences := make([][]Outcome, 50)
+	for i := range sentences {
+		sentences[i] = make([]Outcome, random.Intn(5) + 1)
+		for j := range sentences[i] {
+			sentences[i][j] = Outcome(random.Intn(3))
+		}
+	}
+	config := DefaultEMConfiguration()
+	config.Tolerance = 0
+	calls := 0
+	config.Callback = func(iteration int, log_likelihood float64, hmm HMM) {
+		calls++
+	}
+	_, log_likelihoods, skipped := BaumWelch(randomHMM(1, 5), sentences, config)
+	if len(skipped) != len(log_likelihoods) {
+		t.Errorf("Skipped counts for %d of %d iterations.", len(skipped), len(log_likelihoods))
+	}
+	if calls != len(log_likelihoods) {
+		t.Errorf("Callback called %d times for %d iterations.", calls, len(log_likelihoods))
+	}
+	for i := 1; i < len(log_likelihoods); i++ {
+		if log_likelihoods[i] < log_likelihoods[i - 1] - 1e-9 {
+			t.Errorf("Likelihood decreased at iteration %d: %f to %f.",
+				i, log_likelihoods[i - 1], log_likelihoods[i])
+		}
+	}
+}
+
+func Test_TrainEMNewWords(t *testing.T) {
+	train, _ := TagFormat{}.ReadCorpus(strings.NewReader(tagging_data))
+	tagger := EstimateFromCorpus(train, DefaultHmmConfiguration())
+	tagger.hmm = tagger.hmm.WithTagDictionary(NewTagDictionary(CountsFromCorpus(train, 1), 1))
+	untagged, _ := TextFormat{}.ReadCorpus(strings.NewReader("The girl walked\nThe boy walked to the store .\n"))
+
+	config := DefaultEMConfiguration()
+	config.MaxIterations = 3
+	trained, log_likelihoods, skipped := tagger.TrainEM(untagged, config)
+	for i, n := range skipped {
+		if n != 0 {
+			t.Errorf("Iteration %d skipped %d sentences.", i, n)
+		}
+	}
+	if math.IsInf(log_likelihoods[0], -1) || log_likelihoods[0] == 0 {
+		t.Errorf("Sentences with new words contributed nothing: %v", log_likelihoods)
+	}
+	if trained.hmm.dictionary == nil {
+		t.Errorf("Tag dictionary dropped by EM.")
+	}
+	girl, _ := trained.lexicon.LookupWordId("girl")
+	if trained.hmm.ProbEmission(State(trained.lexicon.GetTagId("N")), Outcome(girl)) == 0 {
+		t.Errorf("New word has no emission probability as N.")
+	}
+}
+
+func Test_ExtendedEmissionsNormalize(t *testing.T) {
+	corpus, err := TagFormat{}.ReadCorpus(strings.NewReader(tagging_data + tagging_data2))
+	if err != nil {
+		t.Fatalf("Couldn't parse: %s", err)
+	}
+	counts := CountsFromCorpus(corpus, 1)
+	estimators := []Estimator{nil, AddKEstimator{0.1}, WittenBellEstimator{},
+		AbsoluteDiscountingEstimator{0.5}, GoodTuringEstimator{}}
+	for _, estimator := range estimators {
+		hmm := EstimateHMM(counts, HMMEstimators{Emission: estimator})
+		extended := hmm.withOutcomes(hmm.num_outcomes + 5, DefaultUnseenEmissionWeight)
+		var state State
+		for state = 0; state < extended.Stop(); state++ {
+			sum := 0.0
+			var outcome Outcome
+			for outcome = 0; outcome <= extended.num_outcomes; outcome++ {
+				sum += extended.ProbEmission(state, outcome)
+			}
+			if math.Abs(sum - 1) > 1e-9 {
+				t.Errorf("%T: state %d emissions sum to %f after extension.", estimator, state, sum)
+			}
+		}
+	}
+}
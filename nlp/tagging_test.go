@@ -39,7 +39,7 @@ func Test_Read(t *testing.T) {
 	corpus2, _ := TagFormat{}.ReadCorpus(strings.NewReader(tagging_data2))
 	err = CheckSameCorpus(corpus, corpus2)
 	if err == nil {
-		t.Errorf("Same check failed.", err)
+		t.Errorf("Same check failed.")
 	}
 
 	change_corpus, _ := TagFormat{}.ReadCorpus(strings.NewReader(tagging_data))
@@ -55,6 +55,126 @@ func Test_Read(t *testing.T) {
 	if results.SentencesResult.NumIncorrect() != 1 {
 		t.Errorf("Sentence correct fail.")
 	}
+	confused_tag := corpus.lexicon.GetTag(corpus.sentences[0][2].tag_id)
+	if n := results.Confusion.Count(confused_tag, "N"); n != 1 {
+		t.Errorf("Confusion count %s/N: %d", confused_tag, n)
+	}
+	if len(results.TopConfusions) != 1 || results.TopConfusions[0] != (Confusion{confused_tag, "N", 1}) {
+		t.Errorf("Top confusions: %v", results.TopConfusions)
+	}
+}
+
+func Test_ScorePRF(t *testing.T) {
+	gold, _ := TagFormat{}.ReadCorpus(strings.NewReader(tagging_data))
+	test, _ := TagFormat{}.ReadCorpus(strings.NewReader(
+		"The/DT boy/N walked/N to/IN the/DT store/NN ./.\n"))
+	results := ScoreTagging(gold, test)
+	scores := make(map[string]PRFResult)
+	for _, score := range results.TagPRF {
+		scores[score.Name] = score
+	}
+	// N: gold boy and store, predicted boy and walked.
+	if n := scores["N"]; n.Precision != 0.5 || n.Recall != 0.5 || n.F1 != 0.5 {
+		t.Errorf("N scores: %+v", n)
+	}
+	if v := scores["V"]; v.Precision != 0 || v.Recall != 0 || v.Predicted != 0 {
+		t.Errorf("V scores: %+v", v)
+	}
+	if len(results.TestOnlyTags) != 1 || results.TestOnlyTags[0] != "NN" || scores["NN"].Predicted != 1 {
+		t.Errorf("Test only tags: %v %+v", results.TestOnlyTags, scores["NN"])
+	}
+	if micro := results.MicroPRF; micro.Correct != 5 || micro.Precision != 5.0/7 {
+		t.Errorf("Micro scores: %+v", micro)
+	}
+	if macro := results.MacroPRF; macro.Recall != (1+0.5+0+1+1+0)/6.0 {
+		t.Errorf("Macro scores: %+v", macro)
+	}
+}
+
+func Test_ScoreWordClasses(t *testing.T) {
+	train, _ := TagFormat{}.ReadCorpus(strings.NewReader(
+		"The/DT boy/N walked/V ./.\nthe/DT walked/N\n"))
+	gold, _ := TagFormat{}.ReadCorpus(strings.NewReader(tagging_data))
+	test, _ := TagFormat{}.ReadCorpus(strings.NewReader(
+		"The/DT boy/N walked/N to/N the/DT store/N ./.\n"))
+	words := ScoreTaggingWithTraining(gold, test, train).Words
+	if words == nil {
+		t.Fatalf("No word class results.")
+	}
+	expected := []HammingResult{
+		{"known", 4, 5},
+		{"unknown", 1, 2},
+		{"ambiguous", 0, 1},
+		{"unambiguous", 4, 4},
+	}
+	for i, result := range words.List() {
+		if result != expected[i] {
+			t.Errorf("Expected %v, got %v", expected[i], result)
+		}
+	}
+	if ScoreTagging(gold, test).Words != nil {
+		t.Errorf("Word classes without training.")
+	}
+}
+
+func Test_TagFormatStrict(t *testing.T) {
+	corpus, err := TagFormat{}.ReadCorpus(strings.NewReader(
+		"8/28/1941/CD and/or/CC a\\/b/N x/A\\/B back\\\\/N\nlast/JJ"))
+	if err != nil {
+		t.Fatalf("Couldn't parse: %s", err)
+	}
+	if n := corpus.NumSentences(); n != 2 {
+		t.Fatalf("Expected 2 sentences, got %d", n)
+	}
+	expected := [][2]string{{"8/28/1941", "CD"}, {"and/or", "CC"}, {"a/b", "N"}, {"x", "A/B"}, {"back\\", "N"}}
+	for i, token := range corpus.sentences[0] {
+		if token.word != expected[i][0] || token.tag != expected[i][1] {
+			t.Errorf("Token %d: expected %v, got %s/%s", i, expected[i], token.word, token.tag)
+		}
+	}
+
+	if Formatter("tag:_:%") != NewTagFormat("_", "%") || Formatter("tag:|") != NewTagFormat("|", "") {
+		t.Errorf("Tag format specs not parsed.")
+	}
+	for _, spec := range []string{"tag:", "tag:_:_", "tag:a b", "tag:_:%:x"} {
+		if Formatter(spec) != nil {
+			t.Errorf("Accepted tag format %q.", spec)
+		}
+	}
+	for _, format := range []TagFormat{{}, NewTagFormat("_", "%")} {
+		var out bytes.Buffer
+		format.FormatCorpus(corpus, &out)
+		reread, err := format.ReadCorpus(&out)
+		if err != nil {
+			t.Fatalf("Couldn't re-read %q: %s", out.String(), err)
+		}
+		for i, sentence := range corpus.sentences {
+			for j, token := range sentence {
+				if other := reread.sentences[i][j]; other.word != token.word || other.tag != token.tag {
+					t.Errorf("Round trip changed %s/%s to %s/%s", token.word, token.tag, other.word, other.tag)
+				}
+			}
+		}
+	}
+
+	malformed := []struct {
+		data, message string
+		line, column  int
+	}{
+		{"The/DT boy\n", "Line 1, token 2: no tag separator \"/\" in \"boy\".", 1, 2},
+		{"ok/N\nThe/DT boy/\n", "Line 2, token 2: empty tag in \"boy/\".", 2, 2},
+		{"/N\n", "Line 1, token 1: empty word in \"/N\".", 1, 1},
+	}
+	for _, c := range malformed {
+		_, err := TagFormat{}.ReadCorpus(strings.NewReader(c.data))
+		parse_error, ok := err.(ParseError)
+		if !ok || err.Error() != c.message {
+			t.Errorf("Expected %q, got %v", c.message, err)
+		} else if parse_error.Line != c.line || parse_error.Column != c.column {
+			t.Errorf("%q at line %d column %d, expected %d and %d.", c.message,
+				parse_error.Line, parse_error.Column, c.line, c.column)
+		}
+	}
 }
 
 func Test_CoNLLRead(t *testing.T) {
@@ -96,3 +216,118 @@ func Test_CoNLLRead(t *testing.T) {
 	}
 
 }
+
+func Test_CoNLLReadRobust(t *testing.T) {
+	full := "1\tNew York\tnew_york\tN\tNNP\tnum=sg\t2\tSUBJ\t2\tSUBJ\n" +
+		"2\truns\trun\tV\tVBZ\t_\t0\tROOT\t_\t_\n"
+	corpus, err := CoNLLFormat{}.ReadCorpus(strings.NewReader(
+		"# a comment\r\n" + strings.Replace(full, "\n", "\r\n", -1) + "\r\n\n" +
+			"1\tOk\t_\tI\tUH\t_\t0\tROOT\t_\t_"))
+	if err != nil {
+		t.Fatalf("Couldn't parse: %s", err)
+	}
+	if n := corpus.NumSentences(); n != 2 {
+		t.Fatalf("Expected 2 sentences, got %d", n)
+	}
+	token := corpus.sentences[0][0]
+	if token.word != "New York" || token.lemma != "new_york" || token.feats != "num=sg" ||
+		token.phead != "2" || token.pdeprel != "SUBJ" {
+		t.Errorf("Columns lost: %+v", token)
+	}
+	var out bytes.Buffer
+	CoNLLFormat{}.FormatCorpus(corpus, &out)
+	if !strings.HasPrefix(out.String(), full+"\n") {
+		t.Errorf("CoNLL round trip failed:\n%s", out.String())
+	}
+
+	malformed := []struct {
+		data, message string
+		line, column  int
+	}{
+		{"1\tSpot\t_\tV\tVB\t_\t2\tAMOD\n", "Line 1, expected 10 tab-separated columns, found 8.", 1, 0},
+		{"# c\n1\tSpot\t_\tV\tVB\t_\tx\tAMOD\t_\t_\n", "Line 2, column 7 (HEAD): expected a head index, found \"x\".", 2, 7},
+		{"1\tSpot\t_\tV\tVB\t_\t0\tROOT\t_\t_\n3\ton\t_\tR\tRP\t_\t1\tAMOD\t_\t_\n", "Line 2, column 1 (ID): expected token 2, found 3.", 2, 1},
+		{"1\t\t_\tV\tVB\t_\t0\tROOT\t_\t_\n", "Line 1, column 2 (FORM): empty field.", 1, 2},
+	}
+	for _, c := range malformed {
+		_, err := CoNLLFormat{}.ReadCorpus(strings.NewReader(c.data))
+		parse_error, ok := err.(ParseError)
+		if !ok || err.Error() != c.message {
+			t.Errorf("Expected %q, got %v", c.message, err)
+		} else if parse_error.Line != c.line || parse_error.Column != c.column {
+			t.Errorf("%q at line %d column %d, expected %d and %d.", c.message,
+				parse_error.Line, parse_error.Column, c.line, c.column)
+		}
+	}
+}
+
+func Test_CoNLLHeads(t *testing.T) {
+	data := "1\tOk\t_\t_\tUH\t_\t_\t_\t_\t_\n\n" +
+		"1\tOk\t_\t_\tUH\t_\t0\t_\t_\t_\n"
+	corpus, err := CoNLLFormat{}.ReadCorpus(strings.NewReader(data))
+	if err != nil {
+		t.Fatalf("Couldn't parse: %s", err)
+	}
+	var out bytes.Buffer
+	CoNLLFormat{}.FormatCorpus(corpus, &out)
+	if !strings.HasPrefix(out.String(), data) {
+		t.Errorf("CoNLL round trip changed heads:\n%s", out.String())
+	}
+	missing := Corpus{sentences: corpus.sentences[:1]}
+	if err := CheckConversion(missing, TagFormat{}); err != nil {
+		t.Errorf("Missing heads reported as dropped: %s", err)
+	}
+	root := Corpus{sentences: corpus.sentences[1:]}
+	if err := CheckConversion(root, TagFormat{}); err == nil || !strings.Contains(err.Error(), "heads") {
+		t.Errorf("Root heads not reported as dropped: %v", err)
+	}
+}
+
+func Test_CheckConversion(t *testing.T) {
+	corpus, err := CoNLLFormat{}.ReadCorpus(strings.NewReader(dep_data))
+	if err != nil {
+		t.Fatalf("Couldn't parse: %s", err)
+	}
+	if err := CheckConversion(corpus, TagFormat{}); err == nil {
+		t.Errorf("Converting CoNLL to tags should drop heads.")
+	}
+	if err := CheckConversion(corpus, CoNLLFormat{}); err != nil {
+		t.Errorf("CoNLL to CoNLL failed: %s", err)
+	}
+	tagged, _ := TagFormat{}.ReadCorpus(strings.NewReader(tagging_data))
+	if err := CheckConversion(tagged, CoNLLFormat{}); err != nil {
+		t.Errorf("Tags to CoNLL failed: %s", err)
+	}
+	if err := CheckConversion(tagged, TextFormat{}); err == nil {
+		t.Errorf("Converting tags to text should drop tags.")
+	}
+
+	// Tag files cannot hold empty tags or words with whitespace, so those
+	// conversions are refused. The others round-trip.
+	cases := []struct {
+		data string
+		ok   bool
+	}{
+		{"1\tNew York\t_\t_\tNNP\t_\t_\t_\t_\t_\n", false},
+		{"1\tThe\t_\t_\t_\t_\t_\t_\t_\t_\n", false},
+		{"1\tNew/York\t_\t_\tNNP\t_\t_\t_\t_\t_\n", true},
+	}
+	for _, c := range cases {
+		corpus, err := CoNLLFormat{}.ReadCorpus(strings.NewReader(c.data))
+		if err != nil {
+			t.Fatalf("Couldn't parse %q: %s", c.data, err)
+		}
+		if err := CheckConversion(corpus, TagFormat{}); (err == nil) != c.ok {
+			t.Errorf("Conversion of %q to tags: %v", c.data, err)
+		}
+		var out bytes.Buffer
+		TagFormat{}.FormatCorpus(corpus, &out)
+		reread, err := TagFormat{}.ReadCorpus(&out)
+		token := corpus.sentences[0][0]
+		round_trip := err == nil && len(reread.sentences[0]) == 1 &&
+			reread.sentences[0][0].word == token.word && reread.sentences[0][0].tag == token.tag
+		if round_trip != c.ok {
+			t.Errorf("Round trip of %q through %q: %v", c.data, out.String(), round_trip)
+		}
+	}
+}
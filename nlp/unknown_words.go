@@ -0,0 +1,105 @@
+package nlp
+
+import (
+	"strings"
+	"unicode"
+)
+
+const UnknownWord = "<UNK>"
+
+// Rewrites rare and unseen words into UNK classes. Words seen at least
+// threshold times in training are kept as they are; any other word becomes
+// UnknownWord, or its signature if signatures are enabled. The same mapper
+// is applied at training and decoding time.
+type WordMapper struct {
+	threshold  int
+	signatures bool
+	known      map[string]bool
+}
+
+// Build a mapper from the word counts of a training lexicon. A threshold of
+// zero keeps every word.
+func NewWordMapper(lexicon *Lexicon, threshold int, signatures bool) WordMapper {
+	mapper := WordMapper{
+		threshold:  threshold,
+		signatures: signatures,
+		known:      make(map[string]bool),
+	}
+	for id := 0; id < lexicon.words.TypesCount(); id++ {
+		if lexicon.words.TypeIdCount(id) >= threshold {
+			mapper.known[lexicon.words.Type(id)] = true
+		}
+	}
+	return mapper
+}
+
+func (mapper WordMapper) Map(word string) string {
+	if mapper.threshold <= 0 || mapper.known[word] {
+		return word
+	}
+	if mapper.signatures {
+		return WordSignature(word)
+	}
+	return UnknownWord
+}
+
+var signatureSuffixes = []string{
+	"ing", "ed", "ion", "ity", "ly", "est", "er", "al", "ive", "ous", "ble", "s", "y",
+}
+
+// The morphological class of a word, such as <UNK-INITC-ed> for a
+// capitalized word ending in "ed". Classes mark capitalization, digits,
+// hyphens and common English suffixes.
+func WordSignature(word string) string {
+	features := []string{"<UNK"}
+	runes := []rune(word)
+	has_lower := false
+	has_digit := false
+	for _, r := range runes {
+		if unicode.IsLower(r) {
+			has_lower = true
+		}
+		if unicode.IsDigit(r) {
+			has_digit = true
+		}
+	}
+	if len(runes) > 0 && unicode.IsUpper(runes[0]) {
+		if has_lower {
+			features = append(features, "INITC")
+		} else {
+			features = append(features, "CAPS")
+		}
+	}
+	if has_digit {
+		features = append(features, "NUM")
+	}
+	if strings.Contains(word, "-") {
+		features = append(features, "DASH")
+	}
+	lower := strings.ToLower(word)
+	for _, suffix := range signatureSuffixes {
+		if len(lower) > len(suffix) + 1 && strings.HasSuffix(lower, suffix) {
+			features = append(features, suffix)
+			break
+		}
+	}
+	return strings.Join(features, "-") + ">"
+}
+
+// Rewrite the words of a corpus through the mapper. The result shares tag and
+// label ids with the original but has a new word lexicon.
+func (mapper WordMapper) MapCorpus(corpus Corpus) (mapped Corpus) {
+	lexicon := corpus.lexicon.Copy()
+	lexicon.words = newDynamicStringMap()
+	for _, sentence := range corpus.sentences {
+		mapped_sentence := make(Sentence, len(sentence))
+		for i, token := range sentence {
+			token.word = mapper.Map(token.word)
+			token.word_id = lexicon.words.UpdateTypeMap(token.word)
+			mapped_sentence[i] = token
+		}
+		mapped.sentences = append(mapped.sentences, mapped_sentence)
+	}
+	mapped.lexicon = lexicon
+	return
+}
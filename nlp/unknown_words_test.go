@@ -0,0 +1,64 @@
+package nlp
+
+import (
+	"strings"
+	"testing"
+)
+
+func Test_WordSignature(t *testing.T) {
+	signatures := map[string]string{
+		"Shakespeare": "<UNK-INITC>",
+		"USA": "<UNK-CAPS>",
+		"1989": "<UNK-NUM>",
+		"walking": "<UNK-ing>",
+		"well-known": "<UNK-DASH>",
+		"Loved": "<UNK-INITC-ed>",
+		"is": "<UNK>",
+	}
+	for word, expected := range signatures {
+		if signature := WordSignature(word); signature != expected {
+			t.Errorf("Signature of %s is %s, expected %s.", word, signature, expected)
+		}
+	}
+}
+
+func Test_WordMapper(t *testing.T) {
+	corpus, err := TagFormat{}.ReadCorpus(strings.NewReader(tagging_data + tagging_data2))
+	if err != nil {
+		t.Fatalf("Couldn't parse: %s", err)
+	}
+	config := DefaultHmmConfiguration()
+	config.unknown_threshold = 2
+	config.signatures = true
+	tagger := EstimateFromCorpus(corpus, config)
+	if _, ok := tagger.Lexicon().LookupWordId("walked"); ok {
+		t.Errorf("Rare word kept in lexicon.")
+	}
+	if _, ok := tagger.Lexicon().LookupWordId("<UNK-ed>"); !ok {
+		t.Errorf("Signature missing from lexicon.")
+	}
+	outcomes := tagger.Outcomes(Sentence{{word: "boy"}, {word: "jumped"}})
+	if jumped, _ := tagger.Lexicon().LookupWordId("<UNK-ed>"); outcomes[1] != Outcome(jumped) {
+		t.Errorf("Unseen word not mapped to its signature.")
+	}
+	if tagger.Lexicon().GetTagId("V") != corpus.lexicon.GetTagId("V") {
+		t.Errorf("Tag ids changed by UNK replacement.")
+	}
+}
+
+func Test_UnknownWordTagger(t *testing.T) {
+	train, dev := readQuestionTreebank(t)
+	for order := 1; order <= 2; order++ {
+		config := DefaultHmmConfiguration()
+		config.order = order
+		config.unknown_threshold = 2
+		config.signatures = true
+		config.estimators = HMMEstimators{
+			Transition: WittenBellEstimator{},
+			Emission: AddKEstimator{0.01},
+		}
+		if accuracy := devAccuracy(t, train, dev, config); accuracy < 0.9 {
+			t.Errorf("Order %d: dev accuracy %0.3f.", order, accuracy)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package server
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/srush/nlp-course/nlp"
+)
+
+// A gold corpus held by the server. Scores against hidden corpora only
+// report aggregate accuracy.
+type GoldCorpus struct {
+	Corpus nlp.Corpus
+	Hidden bool
+}
+
+// Load every corpus in dir, named by its file name without the extension.
+// Corpora in the hidden subdirectory of dir are hidden. Files in formats
+// the nlp package does not know are skipped.
+func LoadGoldCorpora(dir string) (map[string]GoldCorpus, error) {
+	gold := make(map[string]GoldCorpus)
+	if err := loadGoldDir(gold, dir, false); err != nil {
+		return nil, err
+	}
+	hidden := filepath.Join(dir, "hidden")
+	if _, err := os.Stat(hidden); err == nil {
+		if err := loadGoldDir(gold, hidden, true); err != nil {
+			return nil, err
+		}
+	}
+	return gold, nil
+}
+
+func loadGoldDir(gold map[string]GoldCorpus, dir string, hidden bool) error {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, info := range infos {
+		file_name := info.Name()
+		if info.IsDir() || nlp.FormatterFromFile(file_name) == nil {
+			continue
+		}
+		name := strings.TrimSuffix(file_name, filepath.Ext(file_name))
+		if _, ok := gold[name]; ok {
+			return fmt.Errorf("gold corpus %s defined twice", name)
+		}
+		file, err := os.Open(filepath.Join(dir, file_name))
+		if err != nil {
+			return err
+		}
+		corpus, err := nlp.ReadCorpus(file, file_name)
+		file.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %s", file_name, err)
+		}
+		gold[name] = GoldCorpus{Corpus: corpus, Hidden: hidden}
+	}
+	return nil
+}
@@ -0,0 +1,627 @@
+// Package server serves the course tagging evaluator over plain net/http.
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	htemplate "html/template"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/srush/nlp-course/nlp"
+)
+
+// Logger receives the server's informational messages. An App Engine
+// context satisfies it.
+type Logger interface {
+	Infof(format string, args ...interface{})
+}
+
+type stdLogger struct{}
+
+func (stdLogger) Infof(format string, args ...interface{}) {
+	log.Printf(format, args...)
+}
+
+type Config struct {
+	// Directory served under /static/. Nothing is served there if empty.
+	StaticDir string
+
+	// Returns the logger for a request. Defaults to the standard log
+	// package.
+	Logger func(r *http.Request) Logger
+
+	// Gold corpora that requests may name instead of uploading, as loaded
+	// by LoadGoldCorpora.
+	Gold map[string]GoldCorpus
+
+	// If set, every scored submission must give a student id and is
+	// recorded here. Only submissions against named gold corpora count
+	// towards the leaderboard.
+	Store Store
+
+	// Submissions against a named gold corpus are rejected after its
+	// deadline.
+	Deadlines map[string]time.Time
+
+	// The current time. Defaults to time.Now.
+	Now func() time.Time
+
+	// Resamples for each significance test on /compare. Defaults to
+	// DefaultCompareSamples.
+	CompareSamples int
+}
+
+// Fewer resamples than nlp.DefaultSignificanceConfiguration, to bound the
+// time a /compare request takes.
+const DefaultCompareSamples = 1000
+
+type Server struct {
+	config Config
+	mux    *http.ServeMux
+}
+
+func NewServer(config Config) *Server {
+	server := &Server{config: config, mux: http.NewServeMux()}
+	server.mux.HandleFunc("/", server.handler)
+	server.mux.HandleFunc("/get", server.get_handler)
+	server.mux.HandleFunc("/upload", server.upload_handler)
+	server.mux.HandleFunc("/eval", server.eval_handler)
+	server.mux.HandleFunc("/convert", server.convert_handler)
+	server.mux.HandleFunc("/compare", server.compare_handler)
+	server.mux.HandleFunc("/errors", server.errors_handler)
+	server.mux.HandleFunc("/leaderboard", server.leaderboard_handler)
+	if config.StaticDir != "" {
+		server.mux.Handle("/static/",
+			http.StripPrefix("/static/", http.FileServer(http.Dir(config.StaticDir))))
+	}
+	return server
+}
+
+func (server *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	server.mux.ServeHTTP(w, r)
+}
+
+func (server *Server) now() time.Time {
+	if server.config.Now == nil {
+		return time.Now()
+	}
+	return server.config.Now()
+}
+
+func (server *Server) logger(r *http.Request) Logger {
+	if server.config.Logger == nil {
+		return stdLogger{}
+	}
+	return server.config.Logger(r)
+}
+
+type Page struct {
+	Title  string
+	Posted string
+}
+
+func (server *Server) handler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	p := &Page{Title: "hello"}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	startTemplate.Execute(w, p)
+}
+
+func (server *Server) get_handler(w http.ResponseWriter, r *http.Request) {
+	name := r.FormValue("name")
+	p := &Page{Title: "hello", Posted: name}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	postedTemplate.Execute(w, p)
+}
+
+func http_error(w http.ResponseWriter, command string, err error) {
+	http.Error(w, fmt.Sprintf("%s: %s", command, err.Error()),
+		http.StatusInternalServerError)
+}
+
+func (server *Server) convert_handler(w http.ResponseWriter, r *http.Request) {
+	c := server.logger(r)
+	var corpus nlp.Corpus
+	var input_formatter, output_formatter nlp.CorpusFormatter
+	reader, err := r.MultipartReader()
+	if err != nil {
+		http_error(w, "file", err)
+		return
+	}
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			if err == io.EOF {
+				break
+			} else {
+				http_error(w, "part", err)
+				return
+			}
+		}
+		name := part.FormName()
+		switch name {
+		case "corpus":
+			file_name := part.FileName()
+			input_formatter = nlp.FormatterFromFile(file_name)
+			corpus, err = nlp.ReadCorpus(part, file_name)
+		case "outputformat":
+			var format string
+			fmt.Fscanf(part, "%s", &format)
+			c.Infof("Formatter: %s", format)
+			output_formatter = nlp.Formatter(format)
+			if output_formatter == nil {
+				err = fmt.Errorf("unknown format %q", format)
+			}
+		}
+		if err != nil {
+			http_error(w, "Corpus parsing error", err)
+			return
+		}
+	}
+	if output_formatter == nil {
+		http_error(w, "outputformat", errors.New("No output format."))
+		return
+	}
+	// Refuse conversions that would lose annotation, as nlp convert does
+	// without -lossy.
+	err = nlp.CheckFormatConversion(input_formatter, output_formatter)
+	if err == nil {
+		err = nlp.CheckConversion(corpus, output_formatter)
+	}
+	if err != nil {
+		json_error(w, requestError{"conversion", http.StatusBadRequest, err})
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	c.Infof("Formatter: %v", output_formatter)
+	output_formatter.FormatCorpus(corpus, w)
+}
+
+// A failure handling a request, with the step that failed and the HTTP
+// status to report.
+type requestError struct {
+	command string
+	status  int
+	err     error
+}
+
+func (err requestError) Error() string {
+	return fmt.Sprintf("%s: %s", err.command, err.err.Error())
+}
+
+// The fields of a scoring request: a gold and a test corpus, and optionally
+// a training corpus, a second test corpus to compare against, the report
+// type, an error analysis filter and student id. named is set if the
+// gold corpus is one held by the server, and hidden if it is also hidden.
+type scoringForm struct {
+	gold_corpus  nlp.Corpus
+	test_corpus  nlp.Corpus
+	train_corpus *nlp.Corpus
+	gold_name    string
+	test_name    string
+	test2_corpus nlp.Corpus
+	test2_name   string
+	typ          string
+	filter       nlp.ErrorFilter
+	student      string
+	named        bool
+	hidden       bool
+}
+
+// Read and check the gold and test corpora of a multipart scoring request.
+// The gold corpus is either an uploaded file or the name of one of the
+// server's gold corpora.
+func (server *Server) readScoringForm(r *http.Request) (form scoringForm, rerr *requestError) {
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return form, &requestError{"file", http.StatusBadRequest, err}
+	}
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			if err == io.EOF {
+				break
+			} else {
+				return form, &requestError{"part", http.StatusBadRequest, err}
+			}
+		}
+		name := part.FormName()
+
+		switch name {
+		case "gold":
+			form.gold_name = part.FileName()
+			if form.gold_name != "" {
+				form.gold_corpus, err = nlp.ReadCorpus(part, form.gold_name)
+				break
+			}
+			fmt.Fscanf(part, "%s", &form.gold_name)
+			gold, ok := server.config.Gold[form.gold_name]
+			if !ok {
+				return form, &requestError{"gold", http.StatusNotFound,
+					fmt.Errorf("No gold corpus named %q.", form.gold_name)}
+			}
+			form.gold_corpus = gold.Corpus
+			form.named = true
+			form.hidden = gold.Hidden
+		case "test":
+			form.test_name = part.FileName()
+			form.test_corpus, err = nlp.ReadCorpus(part, form.test_name)
+		case "test2":
+			form.test2_name = part.FileName()
+			form.test2_corpus, err = nlp.ReadCorpus(part, form.test2_name)
+		case "train":
+			var train nlp.Corpus
+			if file_name := part.FileName(); file_name != "" {
+				train, err = nlp.ReadCorpus(part, file_name)
+			} else {
+				var train_name string
+				fmt.Fscanf(part, "%s", &train_name)
+				if train_name == "" {
+					break
+				}
+				gold, ok := server.config.Gold[train_name]
+				if !ok {
+					return form, &requestError{"train", http.StatusNotFound,
+						fmt.Errorf("No training corpus named %q.", train_name)}
+				}
+				if gold.Hidden {
+					return form, &requestError{"train", http.StatusForbidden,
+						fmt.Errorf("Gold corpus %q is hidden and cannot be used for training.", train_name)}
+				}
+				train = gold.Corpus
+			}
+			form.train_corpus = &train
+		case "type":
+			fmt.Fscanf(part, "%s", &form.typ)
+		case "student":
+			fmt.Fscanf(part, "%s", &form.student)
+		case "gold_tag":
+			fmt.Fscanf(part, "%s", &form.filter.GoldTag)
+		case "test_tag":
+			fmt.Fscanf(part, "%s", &form.filter.TestTag)
+		case "sort":
+			var sort string
+			fmt.Fscanf(part, "%s", &sort)
+			form.filter.SortByErrors = sort == "errors"
+		}
+		if err != nil {
+			return form, &requestError{"Corpus parsing error", http.StatusBadRequest, err}
+		}
+	}
+
+	// Error check the corpus.
+	if form.test_corpus.NumSentences() == 0 {
+		return form, &requestError{"corpus check", http.StatusBadRequest, errors.New("Test corpus blank.")}
+	}
+	if form.gold_corpus.NumSentences() == 0 {
+		return form, &requestError{"corpus check", http.StatusBadRequest, errors.New("Gold corpus blank.")}
+	}
+	err = nlp.CheckSameCorpus(form.gold_corpus, form.test_corpus)
+	if err != nil {
+		return form, &requestError{"corpus check", http.StatusBadRequest, err}
+	}
+	return form, nil
+}
+
+// Check that a submission may be scored: a named gold corpus must still be
+// open, and a student id is needed whenever submissions are recorded.
+func (server *Server) checkSubmission(form scoringForm, now time.Time) *requestError {
+	if form.named {
+		if deadline, ok := server.config.Deadlines[form.gold_name]; ok && now.After(deadline) {
+			return &requestError{"deadline", http.StatusForbidden,
+				fmt.Errorf("Submissions for %s closed at %s.", form.gold_name, deadline.Format(time.RFC1123))}
+		}
+	}
+	if server.config.Store != nil && form.student == "" {
+		return &requestError{"student", http.StatusBadRequest, errors.New("No student id.")}
+	}
+	return nil
+}
+
+// Score a submission and record it in the store, if there is one.
+// Submissions against named gold corpora are checked against their deadline.
+func (server *Server) score(form scoringForm) (nlp.Results, *requestError) {
+	now := server.now()
+	if rerr := server.checkSubmission(form, now); rerr != nil {
+		return nlp.Results{}, rerr
+	}
+	var results nlp.TaggingResults
+	if form.train_corpus != nil {
+		results = nlp.ScoreTaggingWithTraining(form.gold_corpus, form.test_corpus, *form.train_corpus)
+	} else {
+		results = nlp.ScoreTagging(form.gold_corpus, form.test_corpus)
+	}
+	if server.config.Store != nil {
+		err := server.config.Store.Add(Submission{
+			Student:  form.student,
+			Gold:     form.gold_name,
+			Uploaded: !form.named,
+			Time:     now,
+			Results:  results,
+		})
+		if err != nil {
+			return nlp.Results{}, &requestError{"store", http.StatusInternalServerError, err}
+		}
+	}
+	if form.hidden {
+		results = results.AggregateOnly()
+	}
+	return nlp.Results{
+		Results:  results,
+		GoldName: form.gold_name,
+		TestName: form.test_name,
+	}, nil
+}
+
+func (server *Server) upload_handler(w http.ResponseWriter, r *http.Request) {
+	c := server.logger(r)
+	form, rerr := server.readScoringForm(r)
+	if rerr != nil {
+		json_error(w, *rerr)
+		return
+	}
+
+	// Score the tagging.
+	p, rerr := server.score(form)
+	if rerr != nil {
+		json_error(w, *rerr)
+		return
+	}
+	c.Infof("Type: %s", form.typ)
+	w.Header().Set("Content-Type", nlp.ResultsContentType(form.typ))
+	err := nlp.WriteResults(w, p, form.typ)
+	if err != nil {
+		http_error(w, "results", err)
+	}
+}
+
+var mediaTypes = map[string]string{
+	"application/json": "json",
+	"text/html":        "html",
+	"text/csv":         "csv",
+	"text/plain":       "text",
+}
+
+// Pick a report type from an explicit type field, falling back to the
+// supported type with the highest q-value in the Accept header, then text.
+// Ties go to the earlier type, and q=0 rules a type out.
+func negotiateType(typ string, accept string) string {
+	if typ != "" {
+		return typ
+	}
+	best, best_q := "text", 0.0
+	for _, media_range := range strings.Split(accept, ",") {
+		params := strings.Split(media_range, ";")
+		report, ok := mediaTypes[strings.TrimSpace(params[0])]
+		if !ok {
+			continue
+		}
+		q := 1.0
+		for _, param := range params[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				value, err := strconv.ParseFloat(param[2:], 64)
+				if err != nil {
+					value = 0
+				}
+				q = value
+			}
+		}
+		if q > best_q {
+			best, best_q = report, q
+		}
+	}
+	return best
+}
+
+type errorBody struct {
+	Error   string `json:"error"`
+	Command string `json:"command"`
+	Status  int    `json:"status"`
+}
+
+func json_error(w http.ResponseWriter, rerr requestError) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(rerr.status)
+	json.NewEncoder(w).Encode(errorBody{
+		Error:   rerr.err.Error(),
+		Command: rerr.command,
+		Status:  rerr.status,
+	})
+}
+
+// Score a test corpus against a gold corpus, like /upload, but choose the
+// report type by content negotiation and report errors as JSON.
+func (server *Server) eval_handler(w http.ResponseWriter, r *http.Request) {
+	c := server.logger(r)
+	if r.Method != "POST" {
+		json_error(w, requestError{"method", http.StatusMethodNotAllowed,
+			errors.New("Use POST with gold and test files.")})
+		return
+	}
+	form, rerr := server.readScoringForm(r)
+	if rerr != nil {
+		json_error(w, *rerr)
+		return
+	}
+	typ := negotiateType(form.typ, r.Header.Get("Accept"))
+	c.Infof("Type: %s", typ)
+	p, rerr := server.score(form)
+	if rerr != nil {
+		json_error(w, *rerr)
+		return
+	}
+
+	var buffer bytes.Buffer
+	if err := nlp.WriteResults(&buffer, p, typ); err != nil {
+		json_error(w, requestError{"results", http.StatusInternalServerError, err})
+		return
+	}
+	w.Header().Set("Content-Type", nlp.ResultsContentType(typ))
+	buffer.WriteTo(w)
+}
+
+// Compare two taggings, test and test2, of the gold corpus for
+// significance. Errors are reported as JSON, as for /eval.
+func (server *Server) compare_handler(w http.ResponseWriter, r *http.Request) {
+	c := server.logger(r)
+	if r.Method != "POST" {
+		json_error(w, requestError{"method", http.StatusMethodNotAllowed,
+			errors.New("Use POST with gold, test and test2 files.")})
+		return
+	}
+	form, rerr := server.readScoringForm(r)
+	if rerr != nil {
+		json_error(w, *rerr)
+		return
+	}
+	if rerr := server.checkSubmission(form, server.now()); rerr != nil {
+		json_error(w, *rerr)
+		return
+	}
+	if form.hidden {
+		json_error(w, requestError{"compare", http.StatusForbidden,
+			fmt.Errorf("No comparisons for hidden gold corpus %s.", form.gold_name)})
+		return
+	}
+	if form.test2_corpus.NumSentences() == 0 {
+		json_error(w, requestError{"corpus check", http.StatusBadRequest, errors.New("Second test corpus blank.")})
+		return
+	}
+	if err := nlp.CheckSameCorpus(form.gold_corpus, form.test2_corpus); err != nil {
+		json_error(w, requestError{"corpus check", http.StatusBadRequest, err})
+		return
+	}
+	typ := negotiateType(form.typ, r.Header.Get("Accept"))
+	if typ == "csv" {
+		typ = "text"
+	}
+	c.Infof("Type: %s", typ)
+
+	config := nlp.DefaultSignificanceConfiguration()
+	config.Samples = server.config.CompareSamples
+	if config.Samples <= 0 {
+		config.Samples = DefaultCompareSamples
+	}
+	significance := nlp.CompareTaggings(form.gold_corpus, form.test_corpus, form.test2_corpus, config)
+	significance.GoldName = form.gold_name
+	significance.AName = form.test_name
+	significance.BName = form.test2_name
+	var buffer bytes.Buffer
+	if err := nlp.WriteSignificance(&buffer, significance, typ); err != nil {
+		json_error(w, requestError{"results", http.StatusInternalServerError, err})
+		return
+	}
+	w.Header().Set("Content-Type", nlp.ResultsContentType(typ))
+	buffer.WriteTo(w)
+}
+
+// List the incorrectly tagged sentences of a submission, as HTML unless
+// another type is asked for. Not available for hidden gold corpora. Errors
+// are reported as JSON.
+func (server *Server) errors_handler(w http.ResponseWriter, r *http.Request) {
+	c := server.logger(r)
+	if r.Method != "POST" {
+		json_error(w, requestError{"method", http.StatusMethodNotAllowed,
+			errors.New("Use POST with gold and test files.")})
+		return
+	}
+	form, rerr := server.readScoringForm(r)
+	if rerr != nil {
+		json_error(w, *rerr)
+		return
+	}
+	if rerr := server.checkSubmission(form, server.now()); rerr != nil {
+		json_error(w, *rerr)
+		return
+	}
+	if form.hidden {
+		json_error(w, requestError{"errors", http.StatusForbidden,
+			fmt.Errorf("No error analysis for hidden gold corpus %s.", form.gold_name)})
+		return
+	}
+	typ := form.typ
+	if typ == "" {
+		typ = "html"
+	}
+	c.Infof("Type: %s", typ)
+
+	analysis := nlp.ErrorAnalysis{
+		GoldName:  form.gold_name,
+		TestName:  form.test_name,
+		Filter:    form.filter,
+		Sentences: nlp.AnalyzeErrors(form.gold_corpus, form.test_corpus, form.filter),
+	}
+	var buffer bytes.Buffer
+	if err := nlp.WriteErrorAnalysis(&buffer, analysis, typ); err != nil {
+		json_error(w, requestError{"results", http.StatusInternalServerError, err})
+		return
+	}
+	w.Header().Set("Content-Type", nlp.ResultsContentType(typ))
+	buffer.WriteTo(w)
+}
+
+// Show each student's best scores on each gold corpus, as HTML or, if asked
+// for with the type parameter or Accept header, JSON.
+func (server *Server) leaderboard_handler(w http.ResponseWriter, r *http.Request) {
+	if server.config.Store == nil {
+		http.NotFound(w, r)
+		return
+	}
+	submissions, err := server.config.Store.Submissions()
+	if err != nil {
+		http_error(w, "store", err)
+		return
+	}
+	leaderboard := Leaderboard(submissions)
+	if negotiateType(r.FormValue("type"), r.Header.Get("Accept")) == "json" {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		json.NewEncoder(w).Encode(leaderboard)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	leaderboardTemplate.Execute(w, leaderboard)
+}
+
+const posted = `You posted : {{.Posted}}`
+
+var postedTemplate = htemplate.Must(htemplate.New("posted").Parse(posted))
+
+const start = `
+<form method="post" action="/upload" enctype="multipart/form-data">
+<input type="file" name="gold"/>
+<input type="file" name = "test"/>
+Training (optional): <input type="file" name="train"/>
+Student id: <input type="text" name="student"/>
+<input type="hidden" name="html" value="true">
+<input type=submit>
+</form>
+`
+
+var startTemplate = htemplate.Must(htemplate.New("start").Parse(start))
+
+const leaderboardHtml = `
+<html>
+<title>Leaderboard</title>
+<body>
+<table>
+<tr><th>Gold</th><th>Student</th><th>Tag Accuracy</th><th>Sentence Accuracy</th><th>Submissions</th><th>Last</th></tr>
+{{range .}}
+<tr><td>{{.Gold}}</td><td>{{.Student}}</td><td>{{printf "%0.3f" .TagAccuracy}}</td><td>{{printf "%0.3f" .SentenceAccuracy}}</td><td>{{.Submissions}}</td><td>{{.Last.Format "2006-01-02 15:04"}}</td></tr>
+{{end}}
+</table>
+</body>
+</html>
+`
+
+var leaderboardTemplate = htemplate.Must(htemplate.New("leaderboard").Parse(leaderboardHtml))
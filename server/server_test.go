@@ -0,0 +1,403 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/srush/nlp-course/nlp"
+)
+
+const gold_data = `The/DT boy/N walked/V to/IN the/DT store/N ./.
+`
+
+const test_data = `The/DT boy/N walked/N to/IN the/DT store/N ./.
+`
+
+type formPart struct {
+	name      string
+	file_name string
+	content   string
+}
+
+func post(t *testing.T, handler http.Handler, path string, parts []formPart) *httptest.ResponseRecorder {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for _, part := range parts {
+		var err error
+		if part.file_name != "" {
+			var field io.Writer
+			field, err = writer.CreateFormFile(part.name, part.file_name)
+			if err == nil {
+				_, err = field.Write([]byte(part.content))
+			}
+		} else {
+			err = writer.WriteField(part.name, part.content)
+		}
+		if err != nil {
+			t.Fatalf("Couldn't build form: %s", err)
+		}
+	}
+	writer.Close()
+	request := httptest.NewRequest("POST", path, &body)
+	request.Header.Set("Content-Type", writer.FormDataContentType())
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func Test_Upload(t *testing.T) {
+	server := NewServer(Config{})
+	response := post(t, server, "/upload", []formPart{
+		{"gold", "gold.tag", gold_data},
+		{"test", "test.tag", test_data},
+	})
+	if response.Code != http.StatusOK {
+		t.Fatalf("Upload failed: %d %s", response.Code, response.Body.String())
+	}
+	if !strings.Contains(response.Body.String(), "Accuracy: 0.857") {
+		t.Errorf("Unexpected report:\n%s", response.Body.String())
+	}
+
+	response = post(t, server, "/upload", []formPart{
+		{"gold", "gold.tag", gold_data},
+		{"test", "test.tag", gold_data + gold_data},
+	})
+	if response.Code != http.StatusBadRequest {
+		t.Errorf("Mismatched corpora scored: %d", response.Code)
+	}
+}
+
+func Test_Convert(t *testing.T) {
+	server := NewServer(Config{})
+	response := post(t, server, "/convert", []formPart{
+		{"corpus", "gold.tag", gold_data},
+		{"outputformat", "", "conll"},
+	})
+	if response.Code != http.StatusOK {
+		t.Fatalf("Convert failed: %d %s", response.Code, response.Body.String())
+	}
+	if !strings.HasPrefix(response.Body.String(), "1\tThe\t") {
+		t.Errorf("Unexpected conversion:\n%s", response.Body.String())
+	}
+	conll := "1\tSpot\t_\tV\tVB\t_\t0\tROOT\t_\t_\n\n"
+	for _, format := range []string{"tag", "conllu"} {
+		response = post(t, server, "/convert", []formPart{
+			{"corpus", "gold.conll", conll},
+			{"outputformat", "", format},
+		})
+		var body errorBody
+		if err := json.Unmarshal(response.Body.Bytes(), &body); err != nil {
+			t.Fatalf("Error body is not JSON: %s", response.Body.String())
+		}
+		if response.Code != http.StatusBadRequest || body.Command != "conversion" {
+			t.Errorf("Lossy conversion to %s: %d %+v", format, response.Code, body)
+		}
+	}
+}
+
+func Test_Static(t *testing.T) {
+	server := NewServer(Config{StaticDir: "../static"})
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, httptest.NewRequest("GET", "/static/qtb-dev.tag", nil))
+	body, _ := ioutil.ReadAll(recorder.Body)
+	if recorder.Code != http.StatusOK || !bytes.HasPrefix(body, []byte("What/WP")) {
+		t.Errorf("Static file not served: %d", recorder.Code)
+	}
+}
+
+func Test_Eval(t *testing.T) {
+	server := NewServer(Config{})
+	parts := []formPart{
+		{"gold", "gold.tag", gold_data},
+		{"test", "test.tag", test_data},
+	}
+	response := post(t, server, "/eval", parts)
+	if response.Code != http.StatusOK || !strings.Contains(response.Body.String(), "Accuracy: 0.857") {
+		t.Errorf("Eval failed: %d %s", response.Code, response.Body.String())
+	}
+	response = post(t, server, "/eval", append(parts, formPart{"type", "", "csv"}))
+	if !strings.HasPrefix(response.Header().Get("Content-Type"), "text/csv") ||
+		!strings.Contains(response.Body.String(), "tags,,6,7,0.8571") {
+		t.Errorf("CSV eval failed: %s", response.Body.String())
+	}
+
+	response = post(t, server, "/eval", []formPart{
+		{"gold", "gold.tag", gold_data},
+		{"test", "test.tag", gold_data + gold_data},
+	})
+	var body errorBody
+	if err := json.Unmarshal(response.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Error body is not JSON: %s", response.Body.String())
+	}
+	if response.Code != http.StatusBadRequest || body.Command != "corpus check" {
+		t.Errorf("Unexpected error: %d %+v", response.Code, body)
+	}
+}
+
+func Test_EvalTraining(t *testing.T) {
+	server := NewServer(Config{})
+	response := post(t, server, "/eval", []formPart{
+		{"gold", "gold.tag", gold_data},
+		{"test", "test.tag", test_data},
+		{"train", "train.tag", "The/DT boy/N ./.\n"},
+		{"type", "", "json"},
+	})
+	var results nlp.Results
+	if err := json.Unmarshal(response.Body.Bytes(), &results); err != nil {
+		t.Fatalf("Bad response %q: %s", response.Body.String(), err)
+	}
+	words := results.Results.Words
+	if words == nil || words.Known.Total != 3 || words.Unknown.Total != 4 || words.Unknown.Correct != 3 {
+		t.Errorf("Unexpected word classes: %+v", words)
+	}
+}
+
+func Test_Compare(t *testing.T) {
+	server := NewServer(Config{})
+	response := post(t, server, "/compare", []formPart{
+		{"gold", "gold.tag", gold_data},
+		{"test", "a.tag", gold_data},
+		{"test2", "b.tag", test_data},
+		{"type", "", "json"},
+	})
+	var significance nlp.Significance
+	if err := json.Unmarshal(response.Body.Bytes(), &significance); err != nil {
+		t.Fatalf("Bad response %q: %s", response.Body.String(), err)
+	}
+	if significance.AName != "a.tag" || significance.Tags.Difference >= 0 ||
+		significance.Samples != DefaultCompareSamples {
+		t.Errorf("Unexpected comparison: %+v", significance)
+	}
+	response = post(t, server, "/compare", []formPart{
+		{"gold", "gold.tag", gold_data},
+		{"test", "a.tag", gold_data},
+	})
+	if response.Code != http.StatusBadRequest {
+		t.Errorf("Compare without test2: %d", response.Code)
+	}
+}
+
+func Test_Errors(t *testing.T) {
+	server := NewServer(Config{})
+	response := post(t, server, "/errors", []formPart{
+		{"gold", "gold.tag", gold_data},
+		{"test", "test.tag", test_data},
+		{"gold_tag", "", "V"},
+	})
+	body := response.Body.String()
+	if response.Code != http.StatusOK || !strings.Contains(body, "Sentence 1: 1 errors") ||
+		!strings.Contains(body, `<td class="error">walked</td>`) {
+		t.Errorf("Unexpected error analysis %d: %s", response.Code, body)
+	}
+	response = post(t, server, "/errors", []formPart{
+		{"gold", "gold.tag", gold_data},
+		{"test", "test.tag", test_data},
+		{"gold_tag", "", "N"},
+	})
+	if strings.Contains(response.Body.String(), "Sentence 1") {
+		t.Errorf("Gold tag filter ignored: %s", response.Body.String())
+	}
+	response = post(t, server, "/errors", []formPart{
+		{"gold", "gold.tag", gold_data},
+	})
+	var body_error errorBody
+	if err := json.Unmarshal(response.Body.Bytes(), &body_error); err != nil ||
+		response.Code != http.StatusBadRequest || body_error.Status != http.StatusBadRequest {
+		t.Errorf("Expected a JSON error, got %d: %s", response.Code, response.Body.String())
+	}
+}
+
+func Test_NegotiateType(t *testing.T) {
+	cases := []struct{ typ, accept, expected string }{
+		{"", "*/*", "text"},
+		{"", "application/json", "json"},
+		{"", "text/html,application/xhtml+xml;q=0.9", "html"},
+		{"", "text/csv; q=1", "csv"},
+		{"json", "text/html", "json"},
+		{"", "text/html;q=0.1, application/json", "json"},
+		{"", "text/csv;q=0.5, text/html;q=0.8", "html"},
+		{"", "application/json;q=0", "text"},
+	}
+	for _, c := range cases {
+		if typ := negotiateType(c.typ, c.accept); typ != c.expected {
+			t.Errorf("negotiateType(%q, %q) = %q, expected %q.", c.typ, c.accept, typ, c.expected)
+		}
+	}
+}
+
+func Test_NamedGold(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gold")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.Mkdir(filepath.Join(dir, "hidden"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "dev.tag"), []byte(gold_data), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "hidden", "test.tag"), []byte(gold_data), 0644)
+	gold, err := LoadGoldCorpora(dir)
+	if err != nil {
+		t.Fatalf("Couldn't load gold: %s", err)
+	}
+	if len(gold) != 2 || gold["dev"].Hidden || !gold["test"].Hidden {
+		t.Fatalf("Unexpected gold corpora: %v", gold)
+	}
+
+	server := NewServer(Config{Gold: gold})
+	response := post(t, server, "/eval", []formPart{
+		{"gold", "", "dev"},
+		{"test", "test.tag", test_data},
+		{"type", "", "json"},
+	})
+	if !strings.Contains(response.Body.String(), `"Name":"V"`) {
+		t.Errorf("Public gold missing per-tag results: %s", response.Body.String())
+	}
+	response = post(t, server, "/eval", []formPart{
+		{"gold", "", "test"},
+		{"test", "test.tag", test_data},
+		{"type", "", "json"},
+	})
+	if response.Code != http.StatusOK || strings.Contains(response.Body.String(), `"Name":"V"`) {
+		t.Errorf("Hidden gold leaked per-tag results: %s", response.Body.String())
+	}
+	response = post(t, server, "/eval", []formPart{
+		{"gold", "", "missing"},
+		{"test", "test.tag", test_data},
+	})
+	if response.Code != http.StatusNotFound {
+		t.Errorf("Unknown gold corpus: %d", response.Code)
+	}
+	response = post(t, server, "/eval", []formPart{
+		{"gold", "", "dev"},
+		{"test", "test.tag", test_data},
+		{"train", "", "test"},
+	})
+	if response.Code != http.StatusForbidden {
+		t.Errorf("Trained on hidden gold corpus: %d", response.Code)
+	}
+	response = post(t, server, "/compare", []formPart{
+		{"gold", "", "test"},
+		{"test", "a.tag", test_data},
+		{"test2", "b.tag", gold_data},
+	})
+	if response.Code != http.StatusForbidden {
+		t.Errorf("Compared on hidden gold corpus: %d", response.Code)
+	}
+}
+
+func Test_Leaderboard(t *testing.T) {
+	dir, err := ioutil.TempDir("", "store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store, err := OpenFileStore(filepath.Join(dir, "submissions.jsonl"))
+	if err != nil {
+		t.Fatalf("Couldn't open store: %s", err)
+	}
+	ioutil.WriteFile(filepath.Join(dir, "dev.tag"), []byte(gold_data), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "old.tag"), []byte(gold_data), 0644)
+	gold, err := LoadGoldCorpora(dir)
+	if err != nil {
+		t.Fatalf("Couldn't load gold: %s", err)
+	}
+	now := time.Date(2012, 3, 1, 12, 0, 0, 0, time.UTC)
+	server := NewServer(Config{
+		Gold:      gold,
+		Store:     store,
+		Deadlines: map[string]time.Time{"old": now.Add(-time.Hour)},
+		Now:       func() time.Time { return now },
+	})
+	submit := func(student, gold_name, test string) *httptest.ResponseRecorder {
+		return post(t, server, "/eval", []formPart{
+			{"gold", "", gold_name},
+			{"test", "test.tag", test},
+			{"student", "", student},
+			{"type", "", "json"},
+		})
+	}
+	if response := submit("", "dev", gold_data); response.Code != http.StatusBadRequest {
+		t.Errorf("Submission without student id: %d", response.Code)
+	}
+	if response := submit("alice", "old", gold_data); response.Code != http.StatusForbidden {
+		t.Errorf("Submission after deadline: %d", response.Code)
+	}
+	response := post(t, server, "/compare", []formPart{
+		{"gold", "", "old"},
+		{"test", "a.tag", test_data},
+		{"test2", "b.tag", gold_data},
+		{"student", "", "alice"},
+	})
+	if response.Code != http.StatusForbidden {
+		t.Errorf("Comparison after deadline: %d", response.Code)
+	}
+	response = post(t, server, "/upload", []formPart{
+		{"gold", "", "old"},
+		{"test", "test.tag", gold_data},
+		{"student", "", "alice"},
+	})
+	if response.Code != http.StatusForbidden {
+		t.Errorf("Upload after deadline: %d", response.Code)
+	}
+	response = post(t, server, "/upload", []formPart{
+		{"gold", "", "dev"},
+		{"test", "test.tag", gold_data},
+	})
+	if response.Code != http.StatusBadRequest {
+		t.Errorf("Upload without student id: %d", response.Code)
+	}
+	response = post(t, server, "/errors", []formPart{
+		{"gold", "", "dev"},
+		{"test", "test.tag", test_data},
+	})
+	if response.Code != http.StatusBadRequest {
+		t.Errorf("Error analysis without student id: %d", response.Code)
+	}
+	submit("alice", "dev", test_data)
+	submit("alice", "dev", gold_data)
+	submit("bob", "dev", test_data)
+
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, httptest.NewRequest("GET", "/leaderboard?type=json", nil))
+	var leaderboard []LeaderboardEntry
+	if err := json.Unmarshal(recorder.Body.Bytes(), &leaderboard); err != nil {
+		t.Fatalf("Bad leaderboard %q: %s", recorder.Body.String(), err)
+	}
+	if len(leaderboard) != 2 || leaderboard[0].Student != "alice" ||
+		leaderboard[0].Submissions != 2 || leaderboard[0].TagAccuracy != 1 {
+		t.Errorf("Unexpected leaderboard: %+v", leaderboard)
+	}
+	if leaderboard[1].Student != "bob" || leaderboard[1].TagAccuracy >= 1 {
+		t.Errorf("Unexpected leaderboard: %+v", leaderboard)
+	}
+
+	// Uploaded gold corpora are recorded but kept off the leaderboard.
+	response = post(t, server, "/upload", []formPart{
+		{"gold", "dev.tag", gold_data},
+		{"test", "test.tag", gold_data},
+		{"student", "", "carol"},
+	})
+	if response.Code != http.StatusOK {
+		t.Fatalf("Upload failed: %d %s", response.Code, response.Body.String())
+	}
+	reopened, err := OpenFileStore(filepath.Join(dir, "submissions.jsonl"))
+	if err != nil {
+		t.Fatalf("Couldn't reopen store: %s", err)
+	}
+	submissions, _ := reopened.Submissions()
+	if len(submissions) != 4 || !submissions[3].Uploaded || submissions[3].Student != "carol" {
+		t.Errorf("Unexpected submissions: %+v", submissions)
+	}
+	if entries := Leaderboard(submissions); len(entries) != 2 {
+		t.Errorf("Uploaded gold on the leaderboard: %+v", entries)
+	}
+}
@@ -0,0 +1,145 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/srush/nlp-course/nlp"
+)
+
+// A scored submission. Gold names one of the server's gold corpora, or for
+// an Uploaded gold corpus, the uploaded file.
+type Submission struct {
+	Student  string             `json:"student"`
+	Gold     string             `json:"gold"`
+	Uploaded bool               `json:"uploaded,omitempty"`
+	Time     time.Time          `json:"time"`
+	Results  nlp.TaggingResults `json:"results"`
+}
+
+// Persistent storage for submissions.
+type Store interface {
+	Add(submission Submission) error
+	Submissions() ([]Submission, error)
+}
+
+// A Store kept in a local file, one JSON submission per line. Submissions
+// are only ever appended, so the file doubles as a log. They are also kept
+// in memory, so reading them does not touch the file.
+type FileStore struct {
+	path        string
+	mutex       sync.Mutex
+	submissions []Submission
+}
+
+// Open the store at path, creating the file if it does not exist, and load
+// its submissions.
+func OpenFileStore(path string) (*FileStore, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	store := &FileStore{path: path}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var submission Submission
+		if err := json.Unmarshal(scanner.Bytes(), &submission); err != nil {
+			return nil, err
+		}
+		store.submissions = append(store.submissions, submission)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+func (store *FileStore) Add(submission Submission) error {
+	line, err := json.Marshal(submission)
+	if err != nil {
+		return err
+	}
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	file, err := os.OpenFile(store.path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	store.submissions = append(store.submissions, submission)
+	return nil
+}
+
+func (store *FileStore) Submissions() ([]Submission, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	return append([]Submission(nil), store.submissions...), nil
+}
+
+// A student's best scores on one gold corpus.
+type LeaderboardEntry struct {
+	Gold             string    `json:"gold"`
+	Student          string    `json:"student"`
+	TagAccuracy      float64   `json:"tag_accuracy"`
+	SentenceAccuracy float64   `json:"sentence_accuracy"`
+	Submissions      int       `json:"submissions"`
+	Last             time.Time `json:"last"`
+}
+
+// Collect the best tag and sentence accuracy of each student on each named
+// gold corpus, ordered by gold corpus and then by tag accuracy. Submissions
+// with uploaded gold corpora are left out.
+func Leaderboard(submissions []Submission) []LeaderboardEntry {
+	type key struct{ gold, student string }
+	best := make(map[key]*LeaderboardEntry)
+	var entries []*LeaderboardEntry
+	for _, submission := range submissions {
+		if submission.Uploaded {
+			continue
+		}
+		k := key{submission.Gold, submission.Student}
+		entry, ok := best[k]
+		if !ok {
+			entry = &LeaderboardEntry{Gold: submission.Gold, Student: submission.Student}
+			best[k] = entry
+			entries = append(entries, entry)
+		}
+		entry.Submissions++
+		if tags := submission.Results.TagsResult.Percent(); tags > entry.TagAccuracy {
+			entry.TagAccuracy = tags
+		}
+		if sentences := submission.Results.SentencesResult.Percent(); sentences > entry.SentenceAccuracy {
+			entry.SentenceAccuracy = sentences
+		}
+		if submission.Time.After(entry.Last) {
+			entry.Last = submission.Time
+		}
+	}
+	leaderboard := make([]LeaderboardEntry, len(entries))
+	for i, entry := range entries {
+		leaderboard[i] = *entry
+	}
+	sort.SliceStable(leaderboard, func(i, j int) bool {
+		if leaderboard[i].Gold != leaderboard[j].Gold {
+			return leaderboard[i].Gold < leaderboard[j].Gold
+		}
+		return leaderboard[i].TagAccuracy > leaderboard[j].TagAccuracy
+	})
+	return leaderboard
+}